@@ -1,13 +1,17 @@
 package main
 
 import (
-	"devctl/internal/awshelper"
-	"devctl/internal/githelper"
-	"devctl/internal/kubehelper"
-	"devctl/internal/netcheck"
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/config"
+	"devctl/pkg/plugin"
+	"devctl/pkg/printer"
+	"devctl/pkg/runner"
 	"fmt"
 	"github.com/spf13/cobra"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 var (
@@ -16,24 +20,110 @@ var (
 	buildDate = "unknown"
 )
 
+const rootLong = `devctl streamlines developer and SRE workflows across Git, Kubernetes, AWS and networking.
+
+Exit codes:
+  0  success
+  1  unexpected error
+  2  invalid user input or usage
+  3  resource not found
+  4  authentication or authorization failure
+  5  timeout
+  6  remote API error
+  7  a check found problems (stack drift, failed audit, ...)
+  8  a confirmation prompt was declined
+Commands that run another program (git, kubectl, ssh, plugins) exit with that program's code.`
+
 func main() {
+	// Configuration supplies flag defaults, so it is loaded before any command is built
+	// A broken file is skipped rather than fatal: `config set` and `config
+	// path` are how it gets repaired.
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ %v; skipping that file\n", err)
+	}
+	config.SetCurrent(cfg)
+
 	// Set up the root command
-	var rootCmd = &cobra.Command{Use: "devctl"}
+	var started bool
+	var rootCmd = &cobra.Command{
+		Use:           "devctl",
+		Long:          rootLong,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		// Anything failing before this hook is a usage error reported by cobra.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			started = true
+		},
+	}
+	cobra.EnableTraverseRunHooks = true
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return clierr.Wrap(clierr.KindInput, err, "")
+	})
+	printer.AddFlag(rootCmd.PersistentFlags())
+	runner.AddFlag(rootCmd.PersistentFlags())
+	registry := plugin.Default()
 
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
 		Short: "Print the devctl version",
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Printf("Version: %s\nGit SHA: %s\nBuilt at: %s\n", version, gitSha, buildDate)
+			for _, p := range registry.Plugins() {
+				if p.Version() != "" && p.Version() != version {
+					fmt.Printf("Plugin %s: %s\n", p.Name(), p.Version())
+				}
+			}
 		},
 	})
-	rootCmd.AddCommand(netcheck.NewNetCheckCmd())
-	rootCmd.AddCommand(kubehelper.NewKubeHelperCmd())
-	rootCmd.AddCommand(awshelper.NewAwsHelperCmd())
-	rootCmd.AddCommand(githelper.NewGitHelperCmd())
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	// External devctl-<name> executables; compiled-in commands always win.
+	for _, p := range plugin.Discover(plugin.DefaultDirs()...) {
+		if hasSubcommand(rootCmd, p.Name) || registry.Lookup(p.Name) != nil {
+			continue
+		}
+		plugin.Register(plugin.New(p.Name, "", func() *cobra.Command { return p.Command(version) }))
+	}
+
+	if err := registry.Install(rootCmd); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
 		os.Exit(1)
 	}
+
+	// Ctrl-C cancels the command's context, which stops polling loops and
+	// interrupts programs started through runner. A second Ctrl-C, once the
+	// context is done, stops devctl outright.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	cmd, err := rootCmd.ExecuteContextC(ctx)
+	stop()
+	if shutdownErr := registry.Shutdown(); shutdownErr != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", shutdownErr)
+	}
+	if err == nil {
+		return
+	}
+
+	if !started && clierr.KindOf(err) == clierr.KindUnknown {
+		err = clierr.Wrap(clierr.KindInput, err, "")
+	}
+	if !clierr.IsSilent(err) {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	}
+	if clierr.KindOf(err) == clierr.KindInput {
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+	}
+	os.Exit(clierr.ExitCode(err))
+}
+
+func hasSubcommand(cmd *cobra.Command, name string) bool {
+	for _, c := range cmd.Commands() {
+		if c.Name() == name || c.HasAlias(name) {
+			return true
+		}
+	}
+	return name == "help" || name == "completion"
 }
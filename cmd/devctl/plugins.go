@@ -0,0 +1,20 @@
+package main
+
+import (
+	"devctl/internal/awshelper"
+	"devctl/internal/confighelper"
+	"devctl/internal/githelper"
+	"devctl/internal/kubehelper"
+	"devctl/internal/netcheck"
+	"devctl/pkg/plugin"
+)
+
+// Built-in commands. A custom distribution can add its own packages here or
+// blank-import packages that call plugin.Register from their init function.
+func init() {
+	plugin.Register(plugin.New("nw", version, netcheck.NewNetCheckCmd))
+	plugin.Register(plugin.New("kube", version, kubehelper.NewKubeHelperCmd))
+	plugin.Register(plugin.New("aws", version, awshelper.NewAwsHelperCmd))
+	plugin.Register(plugin.New("git", version, githelper.NewGitHelperCmd))
+	plugin.Register(plugin.New("config", version, confighelper.NewConfigHelperCmd))
+}
@@ -1,26 +1,75 @@
 package awshelper
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	_ "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
 
 // Mock S3 client
 type mockS3Client struct {
-	ListBucketsFunc func(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error)
+	S3API
+	ListBucketsFunc      func(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error)
+	GetBucketPolicyFunc  func(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error)
+	HeadObjectFunc       func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObjectTaggingFunc func(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+}
+
+func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return m.HeadObjectFunc(ctx, params, optFns...)
+}
+
+func (m *mockS3Client) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	return m.GetObjectTaggingFunc(ctx, params, optFns...)
 }
 
 func (m *mockS3Client) ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
 	return m.ListBucketsFunc(ctx, params, optFns...)
 }
 
+func (m *mockS3Client) GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+	return m.GetBucketPolicyFunc(ctx, params, optFns...)
+}
+
 // Abstract the creation of the S3 client
 var newS3Client = func(cfg aws.Config) *mockS3Client {
 	return &mockS3Client{
@@ -35,18 +84,517 @@ var newS3Client = func(cfg aws.Config) *mockS3Client {
 	}
 }
 
+// memS3 stores objects in memory for the transfer commands and computes
+// ETags the way S3 does, including those of multipart uploads.
+type memS3 struct {
+	S3API
+	mu        sync.Mutex
+	objects   map[string][]byte // by bucket/key
+	parts     map[int32][]byte
+	multipart map[string]string // ETags of objects uploaded in parts
+	puts      []string
+}
+
+func newMemS3(objects map[string]string) *memS3 {
+	m := &memS3{objects: map[string][]byte{}}
+	for k, v := range objects {
+		m.objects[k] = []byte(v)
+	}
+	return m
+}
+
+func memETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (m *memS3) put(bucket, key string, data []byte) {
+	m.objects[bucket+"/"+key] = data
+	m.puts = append(m.puts, key)
+}
+
+func (m *memS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := &s3.ListObjectsV2Output{}
+	prefix, delimiter := aws.ToString(params.Prefix), aws.ToString(params.Delimiter)
+	for _, name := range slices.Sorted(maps.Keys(m.objects)) {
+		key, ok := strings.CutPrefix(name, aws.ToString(params.Bucket)+"/")
+		if !ok || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			folder := key[:len(prefix)+i+len(delimiter)]
+			if n := len(out.CommonPrefixes); n == 0 || aws.ToString(out.CommonPrefixes[n-1].Prefix) != folder {
+				out.CommonPrefixes = append(out.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(folder)})
+			}
+			continue
+		}
+		data := m.objects[name]
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(key), Size: aws.Int64(int64(len(data))), ETag: aws.String(m.etag(name))})
+	}
+	return out, nil
+}
+
+// etag is the plain MD5, or the multipart form for objects that were
+// uploaded in parts
+func (m *memS3) etag(name string) string {
+	if etag, ok := m.multipart[name]; ok {
+		return etag
+	}
+	return memETag(m.objects[name])
+}
+
+func (m *memS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	start, end := 0, len(data)-1
+	if params.Range != nil {
+		fmt.Sscanf(aws.ToString(params.Range), "bytes=%d-%d", &start, &end)
+		end = min(end, len(data)-1)
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(data[start : end+1])),
+		ContentLength: aws.Int64(int64(end + 1 - start)),
+		ContentRange:  aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(data))),
+	}, nil
+}
+
+func (m *memS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := aws.ToString(params.Bucket) + "/" + aws.ToString(params.Key)
+	data, ok := m.objects[name]
+	if !ok {
+		return nil, &smithy.GenericAPIError{Code: "NotFound"}
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data))), ETag: aws.String(m.etag(name))}, nil
+}
+
+func (m *memS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(aws.ToString(params.Bucket), aws.ToString(params.Key), data)
+	delete(m.multipart, aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key))
+	return &s3.PutObjectOutput{ETag: aws.String(memETag(data))}, nil
+}
+
+func (m *memS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	source, err := url.PathUnescape(aws.ToString(params.CopySource))
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[source]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	m.put(aws.ToString(params.Bucket), aws.ToString(params.Key), data)
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (m *memS3) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range params.Delete.Objects {
+		delete(m.objects, aws.ToString(params.Bucket)+"/"+aws.ToString(id.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (m *memS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parts = map[int32][]byte{}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (m *memS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parts[aws.ToInt32(params.PartNumber)] = data
+	return &s3.UploadPartOutput{ETag: aws.String(memETag(data))}, nil
+}
+
+func (m *memS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var data, sums []byte
+	for _, part := range params.MultipartUpload.Parts {
+		p := m.parts[aws.ToInt32(part.PartNumber)]
+		sum := md5.Sum(p)
+		data, sums = append(data, p...), append(sums, sum[:]...)
+	}
+	name := aws.ToString(params.Bucket) + "/" + aws.ToString(params.Key)
+	m.put(aws.ToString(params.Bucket), aws.ToString(params.Key), data)
+	if m.multipart == nil {
+		m.multipart = map[string]string{}
+	}
+	m.multipart[name] = fmt.Sprintf(`%s-%d"`, strings.TrimSuffix(memETag(sums), `"`), len(params.MultipartUpload.Parts))
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (m *memS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// auditS3 serves the settings the audit reads: the bucket "locked" is
+// configured as the audit wants it, any other bucket is left open.
+type auditS3 struct {
+	S3API
+}
+
+func (auditS3) ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+	return &s3.ListBucketsOutput{Buckets: []types.Bucket{
+		{Name: aws.String("locked"), BucketRegion: aws.String("eu-west-1")},
+		{Name: aws.String("open"), BucketRegion: aws.String("us-east-1")},
+	}}, nil
+}
+
+func (auditS3) GetPublicAccessBlock(ctx context.Context, params *s3.GetPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error) {
+	if aws.ToString(params.Bucket) != "locked" {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchPublicAccessBlockConfiguration"}
+	}
+	on := aws.Bool(true)
+	return &s3.GetPublicAccessBlockOutput{PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+		BlockPublicAcls: on, IgnorePublicAcls: on, BlockPublicPolicy: on, RestrictPublicBuckets: on,
+	}}, nil
+}
+
+func (auditS3) GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+	if aws.ToString(params.Bucket) == "locked" {
+		return &s3.GetBucketPolicyOutput{Policy: aws.String(`{"Statement": {"Effect": "Deny", "Principal": "*", "Action": "s3:*",
+			"Resource": "arn:aws:s3:::locked/*", "Condition": {"Bool": {"aws:SecureTransport": false}}}}`)}, nil
+	}
+	return &s3.GetBucketPolicyOutput{Policy: aws.String(`{"Statement": [
+		{"Sid": "PublicRead", "Effect": "Allow", "Principal": {"AWS": "*"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::open/*"}]}`)}, nil
+}
+
+func (auditS3) GetBucketAcl(ctx context.Context, params *s3.GetBucketAclInput, optFns ...func(*s3.Options)) (*s3.GetBucketAclOutput, error) {
+	if aws.ToString(params.Bucket) == "locked" {
+		return &s3.GetBucketAclOutput{}, nil
+	}
+	return &s3.GetBucketAclOutput{Grants: []types.Grant{{
+		Grantee:    &types.Grantee{Type: types.TypeGroup, URI: aws.String(allUsersGroup)},
+		Permission: types.PermissionRead,
+	}}}, nil
+}
+
+func (auditS3) GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	if aws.ToString(params.Bucket) != "locked" {
+		return nil, &smithy.GenericAPIError{Code: "ServerSideEncryptionConfigurationNotFoundError"}
+	}
+	return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
+		Rules: []types.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{SSEAlgorithm: types.ServerSideEncryptionAwsKms}}},
+	}}, nil
+}
+
+func (auditS3) GetBucketVersioning(ctx context.Context, params *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	if aws.ToString(params.Bucket) != "locked" {
+		return &s3.GetBucketVersioningOutput{Status: types.BucketVersioningStatusSuspended}, nil
+	}
+	return &s3.GetBucketVersioningOutput{Status: types.BucketVersioningStatusEnabled}, nil
+}
+
+func (auditS3) GetBucketLogging(ctx context.Context, params *s3.GetBucketLoggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketLoggingOutput, error) {
+	if aws.ToString(params.Bucket) != "locked" {
+		return nil, &smithy.GenericAPIError{Code: "AccessDenied"}
+	}
+	return &s3.GetBucketLoggingOutput{LoggingEnabled: &types.LoggingEnabled{TargetBucket: aws.String("logs"), TargetPrefix: aws.String("locked/")}}, nil
+}
+
+func (auditS3) GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if aws.ToString(params.Bucket) != "locked" {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: []types.LifecycleRule{{Status: types.ExpirationStatusEnabled}}}, nil
+}
+
+func (auditS3) GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	if aws.ToString(params.Bucket) == "missing" {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchBucket"}
+	}
+	return &s3.GetBucketLocationOutput{}, nil
+}
+
+// Mock EC2 client
+type mockEC2Client struct {
+	EC2API
+	DescribeInstancesFunc      func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	DescribeRegionsFunc        func(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
+	DescribeInstanceStatusFunc func(ctx context.Context, params *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error)
+	DescribeSecurityGroupsFunc func(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error)
+	DescribeVolumesFunc        func(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error)
+	GetConsoleOutputFunc       func(ctx context.Context, params *ec2.GetConsoleOutputInput, optFns ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error)
+	StopInstancesFunc          func(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error)
+	RebootInstancesFunc        func(ctx context.Context, params *ec2.RebootInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RebootInstancesOutput, error)
+	TerminateInstancesFunc     func(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error)
+}
+
+func (m *mockEC2Client) StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	return m.StopInstancesFunc(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) RebootInstances(ctx context.Context, params *ec2.RebootInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RebootInstancesOutput, error) {
+	return m.RebootInstancesFunc(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	return m.TerminateInstancesFunc(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) DescribeInstanceStatus(ctx context.Context, params *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+	return m.DescribeInstanceStatusFunc(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) DescribeSecurityGroups(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return m.DescribeSecurityGroupsFunc(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) DescribeVolumes(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+	return m.DescribeVolumesFunc(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) GetConsoleOutput(ctx context.Context, params *ec2.GetConsoleOutputInput, optFns ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error) {
+	return m.GetConsoleOutputFunc(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return m.DescribeInstancesFunc(ctx, params, optFns...)
+}
+
+func (m *mockEC2Client) DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	return m.DescribeRegionsFunc(ctx, params, optFns...)
+}
+
+// Mock IAM client
+type mockIAMClient struct {
+	IAMAPI
+	ListRolesFunc                func(ctx context.Context, params *iam.ListRolesInput, optFns ...func(*iam.Options)) (*iam.ListRolesOutput, error)
+	GetRoleFunc                  func(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	ListAttachedRolePoliciesFunc func(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error)
+	GetPolicyFunc                func(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	GetPolicyVersionFunc         func(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error)
+	ListRolePoliciesFunc         func(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error)
+	GetRolePolicyFunc            func(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error)
+	SimulatePrincipalPolicyFunc  func(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error)
+}
+
+func (m *mockIAMClient) ListRoles(ctx context.Context, params *iam.ListRolesInput, optFns ...func(*iam.Options)) (*iam.ListRolesOutput, error) {
+	return m.ListRolesFunc(ctx, params, optFns...)
+}
+
+func (m *mockIAMClient) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	return m.GetRoleFunc(ctx, params, optFns...)
+}
+
+func (m *mockIAMClient) ListAttachedRolePolicies(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	return m.ListAttachedRolePoliciesFunc(ctx, params, optFns...)
+}
+
+func (m *mockIAMClient) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	return m.GetPolicyFunc(ctx, params, optFns...)
+}
+
+func (m *mockIAMClient) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	return m.GetPolicyVersionFunc(ctx, params, optFns...)
+}
+
+func (m *mockIAMClient) ListRolePolicies(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	return m.ListRolePoliciesFunc(ctx, params, optFns...)
+}
+
+func (m *mockIAMClient) GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+	return m.GetRolePolicyFunc(ctx, params, optFns...)
+}
+
+func (m *mockIAMClient) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	return m.SimulatePrincipalPolicyFunc(ctx, params, optFns...)
+}
+
+// Mock CloudFormation client
+type mockCFClient struct {
+	CloudFormationAPI
+	DetectStackDriftFunc                  func(ctx context.Context, params *cloudformation.DetectStackDriftInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DetectStackDriftOutput, error)
+	DescribeStackDriftDetectionStatusFunc func(ctx context.Context, params *cloudformation.DescribeStackDriftDetectionStatusInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error)
+	DescribeStackResourceDriftsFunc       func(ctx context.Context, params *cloudformation.DescribeStackResourceDriftsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackResourceDriftsOutput, error)
+	DescribeStacksFunc                    func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error)
+	DescribeStackEventsFunc               func(ctx context.Context, params *cloudformation.DescribeStackEventsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackEventsOutput, error)
+	ListStackResourcesFunc                func(ctx context.Context, params *cloudformation.ListStackResourcesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackResourcesOutput, error)
+	GetTemplateFunc                       func(ctx context.Context, params *cloudformation.GetTemplateInput, optFns ...func(*cloudformation.Options)) (*cloudformation.GetTemplateOutput, error)
+	DeleteStackFunc                       func(ctx context.Context, params *cloudformation.DeleteStackInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteStackOutput, error)
+	CreateChangeSetFunc                   func(ctx context.Context, params *cloudformation.CreateChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.CreateChangeSetOutput, error)
+	DescribeChangeSetFunc                 func(ctx context.Context, params *cloudformation.DescribeChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeChangeSetOutput, error)
+	ExecuteChangeSetFunc                  func(ctx context.Context, params *cloudformation.ExecuteChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ExecuteChangeSetOutput, error)
+	DeleteChangeSetFunc                   func(ctx context.Context, params *cloudformation.DeleteChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteChangeSetOutput, error)
+	ListStacksFunc                        func(ctx context.Context, params *cloudformation.ListStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStacksOutput, error)
+}
+
+func (m *mockCFClient) ListStacks(ctx context.Context, params *cloudformation.ListStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStacksOutput, error) {
+	return m.ListStacksFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) CreateChangeSet(ctx context.Context, params *cloudformation.CreateChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.CreateChangeSetOutput, error) {
+	return m.CreateChangeSetFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) DescribeChangeSet(ctx context.Context, params *cloudformation.DescribeChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeChangeSetOutput, error) {
+	return m.DescribeChangeSetFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) ExecuteChangeSet(ctx context.Context, params *cloudformation.ExecuteChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ExecuteChangeSetOutput, error) {
+	return m.ExecuteChangeSetFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) DeleteChangeSet(ctx context.Context, params *cloudformation.DeleteChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteChangeSetOutput, error) {
+	return m.DeleteChangeSetFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) DescribeStacks(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+	return m.DescribeStacksFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) DescribeStackEvents(ctx context.Context, params *cloudformation.DescribeStackEventsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackEventsOutput, error) {
+	return m.DescribeStackEventsFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) ListStackResources(ctx context.Context, params *cloudformation.ListStackResourcesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackResourcesOutput, error) {
+	return m.ListStackResourcesFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) GetTemplate(ctx context.Context, params *cloudformation.GetTemplateInput, optFns ...func(*cloudformation.Options)) (*cloudformation.GetTemplateOutput, error) {
+	return m.GetTemplateFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) DeleteStack(ctx context.Context, params *cloudformation.DeleteStackInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteStackOutput, error) {
+	return m.DeleteStackFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) DetectStackDrift(ctx context.Context, params *cloudformation.DetectStackDriftInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DetectStackDriftOutput, error) {
+	return m.DetectStackDriftFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) DescribeStackDriftDetectionStatus(ctx context.Context, params *cloudformation.DescribeStackDriftDetectionStatusInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+	return m.DescribeStackDriftDetectionStatusFunc(ctx, params, optFns...)
+}
+
+func (m *mockCFClient) DescribeStackResourceDrifts(ctx context.Context, params *cloudformation.DescribeStackResourceDriftsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackResourceDriftsOutput, error) {
+	return m.DescribeStackResourceDriftsFunc(ctx, params, optFns...)
+}
+
+// Mock SSM client
+type mockSSMClient struct {
+	SSMAPI
+	DescribeInstanceInformationFunc func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error)
+}
+
+func (m *mockSSMClient) DescribeInstanceInformation(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+	return m.DescribeInstanceInformationFunc(ctx, params, optFns...)
+}
+
+// fakeClients hands the mocks to the commands in place of real SDK clients
+type fakeClients struct {
+	s3      S3API
+	presign S3PresignAPI
+	ec2     EC2API
+	cf      CloudFormationAPI
+	iam     IAMAPI
+	ssm     SSMAPI
+	ic      InstanceConnectAPI
+	account string
+	region  string
+	// ec2For, when set, serves a different EC2 client per account and region
+	ec2For func(account, region string) EC2API
+}
+
+func (f *fakeClients) S3(ctx context.Context) (S3API, error) { return f.s3, nil }
+func (f *fakeClients) S3Presign(ctx context.Context) (S3PresignAPI, error) {
+	return f.presign, nil
+}
+func (f *fakeClients) IAM(ctx context.Context) (IAMAPI, error) { return f.iam, nil }
+func (f *fakeClients) SSM(ctx context.Context) (SSMAPI, error) { return f.ssm, nil }
+func (f *fakeClients) InstanceConnect(ctx context.Context) (InstanceConnectAPI, error) {
+	return f.ic, nil
+}
+func (f *fakeClients) ForRegion(region string) ClientFactory {
+	c := *f
+	c.region = region
+	return &c
+}
+func (f *fakeClients) ForAccount(account string) ClientFactory {
+	c := *f
+	c.account = account
+	return &c
+}
+func (f *fakeClients) EC2(ctx context.Context) (EC2API, error) {
+	if f.ec2For != nil {
+		return f.ec2For(f.account, f.region), nil
+	}
+	return f.ec2, nil
+}
+func (f *fakeClients) CloudFormation(ctx context.Context) (CloudFormationAPI, error) {
+	return f.cf, nil
+}
+
+// runAWS executes `aws <args>` against the fake clients and returns stdout
+func runAWS(t *testing.T, clients ClientFactory, args ...string) (string, error) {
+	t.Helper()
+	return runAWSInput(t, clients, "", args...)
+}
+
+// runAWSInput is runAWS with stdin, e.g. answers to confirmation prompts
+func runAWSInput(t *testing.T, clients ClientFactory, stdin string, args ...string) (string, error) {
+	t.Helper()
+	cmd := newAwsHelperCmd(clients)
+	printer.AddFlag(cmd.PersistentFlags())
+	// like main, keep usage and error text out of the output
+	cmd.SilenceUsage, cmd.SilenceErrors = true, true
+
+	var out bytes.Buffer
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&out)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
 // Abstract the loading of AWS config
 var loadAWSConfigFunc = func(ctx context.Context) (aws.Config, error) {
 	return aws.Config{}, errors.New("mock error")
 }
 
 func TestListS3Cmd(t *testing.T) {
-	//mockClient := newS3Client(aws.Config{})
+	mockClient := newS3Client(aws.Config{})
 
 	// Use the mock client in the test
-	cmd := listS3Cmd()
-	err := cmd.RunE(nil, nil)
+	out, err := runAWS(t, &fakeClients{s3: mockClient}, "list-s3", "-o", "name")
 	assert.NoError(t, err)
+	assert.Equal(t, "test-bucket-1\ntest-bucket-2\n", out)
+}
+
+func TestListS3CmdError(t *testing.T) {
+	mockClient := &mockS3Client{
+		ListBucketsFunc: func(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+			return nil, &smithy.GenericAPIError{Code: "ExpiredToken"}
+		},
+	}
+
+	_, err := runAWS(t, &fakeClients{s3: mockClient}, "list-s3")
+	assert.Equal(t, clierr.KindAuth, clierr.KindOf(err))
 }
 
 func TestLoadAWSConfig(t *testing.T) {
@@ -54,3 +602,1504 @@ func TestLoadAWSConfig(t *testing.T) {
 	_, err := loadAWSConfigFunc(context.Background())
 	assert.Error(t, err)
 }
+
+func TestDisplayBucketPolicyCmdNotFound(t *testing.T) {
+	mockClient := &mockS3Client{
+		GetBucketPolicyFunc: func(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+			assert.Equal(t, "missing-bucket", aws.ToString(params.Bucket))
+			return nil, &smithy.GenericAPIError{Code: "NoSuchBucket"}
+		},
+	}
+
+	_, err := runAWS(t, &fakeClients{s3: mockClient}, "display-bucket-policy", "missing-bucket")
+	assert.Equal(t, clierr.KindNotFound, clierr.KindOf(err))
+}
+
+func TestListEC2Cmd(t *testing.T) {
+	mockClient := &mockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+			return &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{{
+					Instances: []ec2types.Instance{{
+						InstanceId:   aws.String("i-0123"),
+						InstanceType: ec2types.InstanceTypeT3Micro,
+						State:        &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning},
+					}},
+				}},
+			}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{ec2: mockClient}, "list-ec2", "-o", "jsonpath={.instanceId} {.state} {.type}")
+	assert.NoError(t, err)
+	assert.Equal(t, "i-0123 running t3.micro\n", out)
+}
+
+func TestListEC2SmallMaxItems(t *testing.T) {
+	var maxResults int32
+	mockClient := &mockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+			maxResults = aws.ToInt32(params.MaxResults)
+			if maxResults < 5 {
+				return nil, &smithy.GenericAPIError{Code: "InvalidParameterValue"}
+			}
+			return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{
+				{InstanceId: aws.String("i-1")}, {InstanceId: aws.String("i-2")}, {InstanceId: aws.String("i-3")},
+			}}}}, nil
+		},
+	}
+
+	// DescribeInstances needs at least 5 results per page; the rest are trimmed
+	out, err := runAWS(t, &fakeClients{ec2: mockClient}, "list-ec2", "--max-items", "1", "-o", "jsonpath={.instanceId}")
+	assert.NoError(t, err)
+	assert.Equal(t, "i-1\n", out)
+	assert.Equal(t, int32(5), maxResults)
+}
+
+func TestListEC2Filters(t *testing.T) {
+	var filters []ec2types.Filter
+	mockClient := &mockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+			filters = params.Filters
+			return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{{
+				InstanceId: aws.String("i-0123"),
+				ImageId:    aws.String("ami-42"),
+				Tags:       []ec2types.Tag{{Key: aws.String("Name"), Value: aws.String("web-1")}},
+				State:      &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning},
+			}}}}}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{ec2: mockClient}, "list-ec2", "--state", "Running", "--name", "web-*",
+		"--tag", "team=web", "--vpc", "vpc-1", "-o", "jsonpath={.name} {.imageId}")
+	assert.NoError(t, err)
+	assert.Equal(t, "web-1 ami-42\n", out)
+	assert.Equal(t, []ec2types.Filter{
+		{Name: aws.String("instance-state-name"), Values: []string{"running"}},
+		{Name: aws.String("tag:Name"), Values: []string{"web-*"}},
+		{Name: aws.String("tag:team"), Values: []string{"web"}},
+		{Name: aws.String("vpc-id"), Values: []string{"vpc-1"}},
+	}, filters)
+
+	_, err = runAWS(t, &fakeClients{ec2: mockClient}, "list-ec2", "--state", "sleeping")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestDisplayEC2Details(t *testing.T) {
+	mockClient := &mockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+			return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{{
+				InstanceId:          aws.String("i-0123"),
+				State:               &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning},
+				IamInstanceProfile:  &ec2types.IamInstanceProfile{Arn: aws.String("arn:aws:iam::123456789012:instance-profile/web")},
+				SecurityGroups:      []ec2types.GroupIdentifier{{GroupId: aws.String("sg-1")}},
+				BlockDeviceMappings: []ec2types.InstanceBlockDeviceMapping{{DeviceName: aws.String("/dev/xvda"), Ebs: &ec2types.EbsInstanceBlockDevice{VolumeId: aws.String("vol-1")}}},
+				NetworkInterfaces: []ec2types.InstanceNetworkInterface{{
+					NetworkInterfaceId: aws.String("eni-1"), SubnetId: aws.String("subnet-1"),
+					PrivateIpAddresses: []ec2types.InstancePrivateIpAddress{{PrivateIpAddress: aws.String("10.0.0.5")}},
+				}},
+			}}}}}, nil
+		},
+		DescribeSecurityGroupsFunc: func(ctx context.Context, params *ec2.DescribeSecurityGroupsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSecurityGroupsOutput, error) {
+			return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: []ec2types.SecurityGroup{{
+				GroupId: aws.String("sg-1"), GroupName: aws.String("web"),
+				IpPermissions: []ec2types.IpPermission{
+					{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(443), ToPort: aws.Int32(443), IpRanges: []ec2types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+					{IpProtocol: aws.String("-1"), UserIdGroupPairs: []ec2types.UserIdGroupPair{{GroupId: aws.String("sg-2")}}},
+				},
+			}}}, nil
+		},
+		DescribeVolumesFunc: func(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+			return &ec2.DescribeVolumesOutput{Volumes: []ec2types.Volume{{
+				VolumeId: aws.String("vol-1"), Size: aws.Int32(30), VolumeType: ec2types.VolumeTypeGp3, Encrypted: aws.Bool(true),
+			}}}, nil
+		},
+		DescribeInstanceStatusFunc: func(ctx context.Context, params *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+			return &ec2.DescribeInstanceStatusOutput{InstanceStatuses: []ec2types.InstanceStatus{{
+				SystemStatus:   &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusOk},
+				InstanceStatus: &ec2types.InstanceStatusSummary{Status: ec2types.SummaryStatusImpaired},
+			}}}, nil
+		},
+		GetConsoleOutputFunc: func(ctx context.Context, params *ec2.GetConsoleOutputInput, optFns ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error) {
+			return nil, errors.New("access denied")
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{ec2: mockClient}, "display-ec2", "i-0123")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "system ok, instance impaired")
+	assert.Contains(t, out, "instance-profile/web")
+	assert.Regexp(t, `eni-1\s+subnet-1\s+10\.0\.0\.5`, out)
+	assert.Regexp(t, `tcp\s+443\s+from 0\.0\.0\.0/0`, out)
+	assert.Regexp(t, `all\s+all\s+from sg-2`, out)
+	assert.Regexp(t, `vol-1\s+/dev/xvda\s+30 GiB\s+gp3\s+encrypted`, out)
+	assert.NotContains(t, out, "Console output")
+
+	mockClient.GetConsoleOutputFunc = func(ctx context.Context, params *ec2.GetConsoleOutputInput, optFns ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error) {
+		return &ec2.GetConsoleOutputOutput{Output: aws.String(base64.StdEncoding.EncodeToString([]byte("boot\nkernel panic\nreboot\n")))}, nil
+	}
+	out, err = runAWS(t, &fakeClients{ec2: mockClient}, "display-ec2", "i-0123", "--console-lines", "2")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Console output (tail):\nkernel panic\nreboot\n")
+}
+
+// fleet serves instances whose states are read from states on every call
+func fleet(states map[string]ec2types.InstanceStateName) func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+		var instances []ec2types.Instance
+		for _, id := range slices.Sorted(maps.Keys(states)) {
+			if len(params.InstanceIds) > 0 && !slices.Contains(params.InstanceIds, id) {
+				continue
+			}
+			instances = append(instances, ec2types.Instance{InstanceId: aws.String(id), State: &ec2types.InstanceState{Name: states[id]}})
+		}
+		return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: instances}}}, nil
+	}
+}
+
+func TestStopEC2ByTagWaitsForStopped(t *testing.T) {
+	pollInterval = time.Millisecond
+	states := map[string]ec2types.InstanceStateName{"i-1": "running", "i-2": "running", "i-3": "stopped"}
+	var filters []ec2types.Filter
+	var stopped []string
+	describe := fleet(states)
+	mockClient := &mockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+			if params.Filters != nil {
+				filters = params.Filters
+			}
+			out, err := describe(ctx, params, optFns...)
+			// the instances stop one poll after the call
+			for _, id := range stopped {
+				states[id] = ec2types.InstanceStateNameStopped
+			}
+			return out, err
+		},
+		StopInstancesFunc: func(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+			stopped = params.InstanceIds
+			for _, id := range stopped {
+				states[id] = ec2types.InstanceStateNameStopping
+			}
+			return &ec2.StopInstancesOutput{}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{ec2: mockClient}, "stop-ec2", "--tag", "env=dev")
+	assert.NoError(t, err)
+	assert.Equal(t, []ec2types.Filter{{Name: aws.String("tag:env"), Values: []string{"dev"}}}, filters)
+	assert.Equal(t, []string{"i-1", "i-2"}, stopped)
+	assert.Contains(t, out, "i-1")
+	assert.NotContains(t, out, "i-3")
+
+	_, err = runAWS(t, &fakeClients{ec2: mockClient}, "stop-ec2")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestRebootEC2WaitsForStatusChecksToRecover(t *testing.T) {
+	pollInterval = time.Millisecond
+	// the checks pass until they notice the reboot, then recover
+	statuses := []ec2types.SummaryStatus{"ok", "ok", "impaired", "initializing", "ok"}
+	var calls int
+	mockClient := &mockEC2Client{
+		DescribeInstancesFunc: fleet(map[string]ec2types.InstanceStateName{"i-1": "running"}),
+		RebootInstancesFunc: func(ctx context.Context, params *ec2.RebootInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RebootInstancesOutput, error) {
+			return &ec2.RebootInstancesOutput{}, nil
+		},
+		DescribeInstanceStatusFunc: func(ctx context.Context, params *ec2.DescribeInstanceStatusInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceStatusOutput, error) {
+			status := statuses[min(calls, len(statuses)-1)]
+			calls++
+			return &ec2.DescribeInstanceStatusOutput{InstanceStatuses: []ec2types.InstanceStatus{{
+				InstanceId:     aws.String("i-1"),
+				InstanceStatus: &ec2types.InstanceStatusSummary{Status: status},
+				SystemStatus:   &ec2types.InstanceStatusSummary{Status: "ok"},
+			}}}, nil
+		},
+	}
+
+	_, err := runAWS(t, &fakeClients{ec2: mockClient}, "reboot-ec2", "i-1")
+	assert.NoError(t, err)
+	assert.Equal(t, len(statuses), calls)
+
+	// checks that never notice the reboot end the wait after the grace period
+	defer func(grace time.Duration) { rebootGrace = grace }(rebootGrace)
+	rebootGrace = 0
+	calls = 0
+	statuses = []ec2types.SummaryStatus{"ok"}
+	_, err = runAWS(t, &fakeClients{ec2: mockClient}, "reboot-ec2", "i-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestTerminateEC2RequiresConfirmation(t *testing.T) {
+	var terminated []string
+	mockClient := &mockEC2Client{
+		DescribeInstancesFunc: fleet(map[string]ec2types.InstanceStateName{"i-1": "running", "i-2": "stopped"}),
+		TerminateInstancesFunc: func(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+			terminated = params.InstanceIds
+			return &ec2.TerminateInstancesOutput{}, nil
+		},
+	}
+
+	_, err := runAWSInput(t, &fakeClients{ec2: mockClient}, "y\n", "terminate-ec2", "i-1", "i-2")
+	assert.Equal(t, clierr.KindAborted, clierr.KindOf(err))
+	assert.Nil(t, terminated)
+
+	out, err := runAWSInput(t, &fakeClients{ec2: mockClient}, "terminate\n", "terminate-ec2", "i-1", "i-2", "--no-wait")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"i-1", "i-2"}, terminated)
+	assert.Contains(t, out, "Terminating 2 instances")
+}
+
+func TestSSHEC2ByName(t *testing.T) {
+	private := func(id string) ec2types.Instance {
+		return ec2types.Instance{InstanceId: aws.String(id), PrivateIpAddress: aws.String("10.0.0.5")}
+	}
+	var instances []ec2types.Instance
+	var filters []ec2types.Filter
+	mockClient := &mockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+			filters = params.Filters
+			return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: instances}}}, nil
+		},
+	}
+	ping := ssmtypes.PingStatusConnectionLost
+	ssmClient := &mockSSMClient{
+		DescribeInstanceInformationFunc: func(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+			return &ssm.DescribeInstanceInformationOutput{InstanceInformationList: []ssmtypes.InstanceInformation{{PingStatus: ping}}}, nil
+		},
+	}
+	clients := &fakeClients{ec2: mockClient, ssm: ssmClient}
+
+	instances = []ec2types.Instance{private("i-1"), private("i-2")}
+	_, err := runAWS(t, clients, "ssh-ec2", "web")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+	assert.ErrorContains(t, err, "i-1, i-2")
+	assert.Contains(t, filters, ec2types.Filter{Name: aws.String("tag:Name"), Values: []string{"web"}})
+
+	// without a public IP or bastion, only SSM can reach the instance
+	instances = instances[:1]
+	_, err = runAWS(t, clients, "ssh-ec2", "web")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+	assert.ErrorContains(t, err, "no online SSM agent")
+
+	ping = ssmtypes.PingStatusOnline
+	t.Setenv("PATH", t.TempDir())
+	_, err = runAWS(t, clients, "ssh-ec2", "web")
+	assert.ErrorContains(t, err, "Session Manager plugin")
+}
+
+func TestSSHEC2EndsOptionsBeforeDestination(t *testing.T) {
+	mockClient := &mockEC2Client{
+		DescribeInstancesFunc: func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+			return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{
+				{InstanceId: aws.String("i-1"), PublicIpAddress: aws.String("203.0.113.7")},
+			}}}}, nil
+		},
+	}
+	dir := t.TempDir()
+	argv := filepath.Join(dir, "argv")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argv + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0o755))
+	t.Setenv("PATH", dir)
+
+	_, err := runAWS(t, &fakeClients{ec2: mockClient}, "ssh-ec2", "i-1", "--user", "-oProxyCommand=x")
+	assert.NoError(t, err)
+	got, err := os.ReadFile(argv)
+	assert.NoError(t, err)
+	assert.Equal(t, "--\n-oProxyCommand=x@203.0.113.7\n", string(got))
+}
+
+func TestSSMEndpoint(t *testing.T) {
+	ctx := context.Background()
+	for region, want := range map[string]string{
+		"eu-west-1":     "https://ssm.eu-west-1.amazonaws.com",
+		"cn-north-1":    "https://ssm.cn-north-1.amazonaws.com.cn",
+		"us-gov-west-1": "https://ssm.us-gov-west-1.amazonaws.com",
+	} {
+		endpoint, err := ssmEndpoint(ctx, ssm.New(ssm.Options{Region: region}).Options())
+		assert.NoError(t, err)
+		assert.Equal(t, want, endpoint, region)
+	}
+
+	endpoint, err := ssmEndpoint(ctx, ssm.New(ssm.Options{Region: "eu-west-1", BaseEndpoint: aws.String("http://localhost:4566")}).Options())
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:4566", endpoint)
+}
+
+func TestInstanceConnectUsesEndpointURL(t *testing.T) {
+	var target, auth string
+	var body map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, auth = r.Header.Get("X-Amz-Target"), r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if body["InstanceOSUser"] == "root" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"com.amazonaws.ec2instanceconnect#AuthException","Message":"denied"}`)
+			return
+		}
+		fmt.Fprint(w, `{"RequestId":"req-1","Success":true}`)
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	ctx := context.Background()
+	client, err := newSDKClients(&clientOptions{region: "eu-west-1", endpointURL: server.URL}).InstanceConnect(ctx)
+	assert.NoError(t, err)
+	send := func(user string) error {
+		_, err := client.SendSSHPublicKey(ctx, &ec2instanceconnect.SendSSHPublicKeyInput{
+			InstanceId: aws.String("i-1"), InstanceOSUser: aws.String(user), SSHPublicKey: aws.String("ssh-ed25519 AAAA"),
+		})
+		return err
+	}
+	assert.NoError(t, send("ec2-user"))
+	assert.Equal(t, "AWSEC2InstanceConnectService.SendSSHPublicKey", target)
+	assert.Contains(t, auth, "/eu-west-1/ec2-instance-connect/aws4_request")
+	assert.Equal(t, map[string]string{"InstanceId": "i-1", "InstanceOSUser": "ec2-user", "SSHPublicKey": "ssh-ed25519 AAAA"}, body)
+
+	err = send("root")
+	var apiErr smithy.APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "AuthException", apiErr.ErrorCode())
+	assert.Equal(t, "denied", apiErr.ErrorMessage())
+}
+
+func TestListBucketObjectsCmdRequiresBucket(t *testing.T) {
+	_, err := runAWS(t, &fakeClients{}, "list-bucket-objects")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestEndpointURL(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<ListAllMyBucketsResult><Buckets>`+
+			`<Bucket><Name>local-bucket</Name></Bucket>`+
+			`</Buckets></ListAllMyBucketsResult>`)
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	root := &cobra.Command{Use: "devctl"}
+	printer.AddFlag(root.PersistentFlags())
+	root.AddCommand(NewAwsHelperCmd())
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{"aws", "list-s3", "--endpoint-url", server.URL, "-o", "name"})
+
+	assert.NoError(t, root.Execute())
+	assert.Equal(t, "local-bucket\n", out.String())
+	assert.Equal(t, 1, requests)
+}
+
+func TestClassifyAWSError(t *testing.T) {
+	tests := []struct {
+		code    string
+		message string
+		want    clierr.Kind
+	}{
+		{"NoSuchBucket", "", clierr.KindNotFound},
+		{"InvalidInstanceID.NotFound", "", clierr.KindNotFound},
+		{"NoSuchEntity", "", clierr.KindNotFound},
+		{"ValidationError", "Stack with id prod does not exist", clierr.KindNotFound},
+		{"ValidationError", "Template format error", clierr.KindInput},
+		{"ExpiredToken", "", clierr.KindAuth},
+		{"AccessDenied", "", clierr.KindAuth},
+		{"UnauthorizedOperation", "", clierr.KindAuth},
+		{"RequestTimeout", "", clierr.KindTimeout},
+		{"InternalError", "", clierr.KindRemote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			err := awsError(&smithy.GenericAPIError{Code: tt.code, Message: tt.message}, "call failed")
+			assert.Equal(t, tt.want, clierr.KindOf(err))
+		})
+	}
+}
+
+// pagedRoles serves roles role-0 ... role-(n-1) in pages of MaxItems (default 3)
+func pagedRoles(n int, calls *int) *mockIAMClient {
+	return &mockIAMClient{
+		ListRolesFunc: func(ctx context.Context, params *iam.ListRolesInput, optFns ...func(*iam.Options)) (*iam.ListRolesOutput, error) {
+			*calls++
+			start, _ := strconv.Atoi(aws.ToString(params.Marker))
+			size := int(aws.ToInt32(params.MaxItems))
+			if size == 0 {
+				size = 3
+			}
+			out := &iam.ListRolesOutput{}
+			for i := start; i < start+size && i < n; i++ {
+				out.Roles = append(out.Roles, iamtypes.Role{RoleName: aws.String(fmt.Sprintf("role-%d", i))})
+			}
+			if start+size < n {
+				out.IsTruncated = true
+				out.Marker = aws.String(strconv.Itoa(start + size))
+			}
+			return out, nil
+		},
+	}
+}
+
+func TestListIAMRolesFollowsPages(t *testing.T) {
+	var calls int
+	out, err := runAWS(t, &fakeClients{iam: pagedRoles(7, &calls)}, "list-iam-roles", "-o", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "role-0\nrole-1\nrole-2\nrole-3\nrole-4\nrole-5\nrole-6\n", out)
+	assert.Equal(t, 3, calls)
+}
+
+func TestListIAMRolesMaxItemsAndResume(t *testing.T) {
+	var calls int
+	clients := &fakeClients{iam: pagedRoles(7, &calls)}
+
+	cmd := newAwsHelperCmd(clients)
+	printer.AddFlag(cmd.PersistentFlags())
+	var out, errOut bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	cmd.SetArgs([]string{"list-iam-roles", "-o", "name", "--page-size", "3", "--max-items", "4"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "role-0\nrole-1\nrole-2\nrole-3\n", out.String())
+
+	token := strings.TrimPrefix(strings.TrimSpace(errOut.String()), "NextToken: ")
+	assert.NotEmpty(t, token)
+
+	// The token resumes in the middle of the second page
+	out2, err := runAWS(t, clients, "list-iam-roles", "-o", "name", "--page-size", "3", "--starting-token", token)
+	assert.NoError(t, err)
+	assert.Equal(t, "role-4\nrole-5\nrole-6\n", out2)
+}
+
+func TestListIAMRolesInvalidStartingToken(t *testing.T) {
+	_, err := runAWS(t, &fakeClients{}, "list-iam-roles", "--starting-token", "!!")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestAssumeRoleCachesCredentials(t *testing.T) {
+	var assumeCalls int
+	var signatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			assumeCalls++
+			r.ParseForm()
+			assert.Equal(t, "AssumeRole", r.Form.Get("Action"))
+			assert.Equal(t, "ci", r.Form.Get("ExternalId"))
+			w.Header().Set("Content-Type", "text/xml")
+			fmt.Fprintf(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>`+
+				`<AccessKeyId>ASIAASSUMED</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>`+
+				`<SessionToken>token</SessionToken><Expiration>%s</Expiration>`+
+				`</Credentials></AssumeRoleResult></AssumeRoleResponse>`,
+				time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+			return
+		}
+		signatures = append(signatures, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<ListAllMyBucketsResult><Buckets></Buckets></ListAllMyBucketsResult>`)
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "base")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "base")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	for i := 0; i < 2; i++ {
+		root := &cobra.Command{Use: "devctl"}
+		printer.AddFlag(root.PersistentFlags())
+		root.AddCommand(NewAwsHelperCmd())
+		root.SetOut(&bytes.Buffer{})
+		root.SetArgs([]string{"aws", "list-s3", "--endpoint-url", server.URL, "--region", "eu-west-1",
+			"--role-arn", "arn:aws:iam::123456789012:role/ReadOnly", "--external-id", "ci"})
+		assert.NoError(t, root.Execute())
+	}
+
+	// the second run reuses the credentials cached by the first
+	assert.Equal(t, 1, assumeCalls)
+	assert.Len(t, signatures, 2)
+	for _, sig := range signatures {
+		assert.Contains(t, sig, "Credential=ASIAASSUMED/")
+		assert.Contains(t, sig, "/eu-west-1/s3/")
+	}
+}
+
+func TestExternalIDRequiresRoleARN(t *testing.T) {
+	_, err := newSDKClients(&clientOptions{externalID: "ci"}).config(context.Background())
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestFileCacheSkipsExpiredCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.json")
+	var calls int
+	provider := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		calls++
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret",
+			CanExpire: true, Expires: time.Now().Add(time.Minute)}, nil
+	})
+
+	cache := &fileCache{path: path, provider: provider}
+	_, err := cache.Retrieve(context.Background())
+	assert.NoError(t, err)
+	// cached, but too close to expiry to be reused
+	_, err = cache.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestFileCacheAssumesRoleOnceAcrossClones(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.json")
+	var calls atomic.Int32
+	provider := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond) // the MFA prompt
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret",
+			CanExpire: true, Expires: time.Now().Add(time.Hour)}, nil
+	})
+
+	// like --all-regions, every region has its own cache for the same file
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache := &fileCache{path: path, provider: provider}
+			creds, err := cache.Retrieve(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "AKID", creds.AccessKeyID)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestListEC2AllRegionsAndAccounts(t *testing.T) {
+	clients := &fakeClients{ec2For: func(account, region string) EC2API {
+		return &mockEC2Client{
+			DescribeRegionsFunc: func(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+				return &ec2.DescribeRegionsOutput{Regions: []ec2types.Region{
+					{RegionName: aws.String("us-east-1")}, {RegionName: aws.String("eu-west-1")},
+				}}, nil
+			},
+			DescribeInstancesFunc: func(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+				if region == "us-east-1" && account == "staging" {
+					return nil, &smithy.GenericAPIError{Code: "UnauthorizedOperation", Message: "denied"}
+				}
+				return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{
+					Instances: []ec2types.Instance{{InstanceId: aws.String("i-" + account + "-" + region)}},
+				}}}, nil
+			},
+		}
+	}}
+
+	out, err := runAWS(t, clients, "list-ec2", "--all-regions", "--accounts", "prod,arn:aws:iam::123456789012:role/ReadOnly,staging",
+		"--concurrency", "2", "-o", "jsonpath={.account} {.region} {.instanceId}")
+	assert.Equal(t, "prod eu-west-1 i-prod-eu-west-1\n"+
+		"prod us-east-1 i-prod-us-east-1\n"+
+		"123456789012 eu-west-1 i-arn:aws:iam::123456789012:role/ReadOnly-eu-west-1\n"+
+		"123456789012 us-east-1 i-arn:aws:iam::123456789012:role/ReadOnly-us-east-1\n"+
+		"staging eu-west-1 i-staging-eu-west-1\n", out)
+	// the failed region doesn't hide the others but still fails the command
+	assert.ErrorContains(t, err, "1 of 6 targets failed")
+	assert.Equal(t, clierr.KindAuth, clierr.KindOf(err))
+}
+
+func TestFanoutRejectsMaxItems(t *testing.T) {
+	_, err := runAWS(t, &fakeClients{}, "list-ec2", "--all-regions", "--max-items", "5")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestCheckStackDriftReportsDifferences(t *testing.T) {
+	pollInterval = 0
+	var polls int
+	cf := &mockCFClient{
+		DetectStackDriftFunc: func(ctx context.Context, params *cloudformation.DetectStackDriftInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DetectStackDriftOutput, error) {
+			assert.Equal(t, "web", aws.ToString(params.StackName))
+			return &cloudformation.DetectStackDriftOutput{StackDriftDetectionId: aws.String("d-1")}, nil
+		},
+		DescribeStackDriftDetectionStatusFunc: func(ctx context.Context, params *cloudformation.DescribeStackDriftDetectionStatusInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+			polls++
+			if polls < 3 {
+				return &cloudformation.DescribeStackDriftDetectionStatusOutput{DetectionStatus: cftypes.StackDriftDetectionStatusDetectionInProgress}, nil
+			}
+			return &cloudformation.DescribeStackDriftDetectionStatusOutput{
+				DetectionStatus:           cftypes.StackDriftDetectionStatusDetectionComplete,
+				StackDriftStatus:          cftypes.StackDriftStatusDrifted,
+				DriftedStackResourceCount: aws.Int32(1),
+			}, nil
+		},
+		DescribeStackResourceDriftsFunc: func(ctx context.Context, params *cloudformation.DescribeStackResourceDriftsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackResourceDriftsOutput, error) {
+			return &cloudformation.DescribeStackResourceDriftsOutput{StackResourceDrifts: []cftypes.StackResourceDrift{
+				{LogicalResourceId: aws.String("Queue"), ResourceType: aws.String("AWS::SQS::Queue"),
+					StackResourceDriftStatus: cftypes.StackResourceDriftStatusInSync},
+				{LogicalResourceId: aws.String("Bucket"), ResourceType: aws.String("AWS::S3::Bucket"),
+					StackResourceDriftStatus: cftypes.StackResourceDriftStatusModified,
+					PropertyDifferences: []cftypes.PropertyDifference{{
+						PropertyPath:   aws.String("/VersioningConfiguration/Status"),
+						DifferenceType: cftypes.DifferenceTypeNotEqual,
+						ExpectedValue:  aws.String("Enabled"),
+						ActualValue:    aws.String("Suspended"),
+					}}},
+			}}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{cf: cf}, "check-stack-drift", "web")
+	assert.Equal(t, clierr.KindCheckFailed, clierr.KindOf(err))
+	assert.Equal(t, 3, polls)
+	assert.Equal(t, "LOGICAL ID   TYPE              STATUS     DIFFERENCES\n"+
+		"Bucket       AWS::S3::Bucket   MODIFIED   1\n"+
+		"Queue        AWS::SQS::Queue   IN_SYNC    0\n"+
+		"\nBucket (AWS::S3::Bucket): MODIFIED\n"+
+		"  /VersioningConfiguration/Status\n"+
+		"    - Enabled\n"+
+		"    + Suspended\n", out)
+}
+
+const webTemplate = `Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: Retain
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      QueueName: !Sub "${AWS::StackName}-jobs"
+`
+
+// webStack serves a stack "web" with a retained bucket and a queue
+func webStack(protected bool) *mockCFClient {
+	return &mockCFClient{
+		DescribeStacksFunc: func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+			return &cloudformation.DescribeStacksOutput{Stacks: []cftypes.Stack{{
+				StackName:                   aws.String("web"),
+				StackId:                     aws.String("arn:aws:cloudformation:us-east-1:123456789012:stack/web/1"),
+				StackStatus:                 cftypes.StackStatusUpdateComplete,
+				EnableTerminationProtection: aws.Bool(protected),
+			}}}, nil
+		},
+		GetTemplateFunc: func(ctx context.Context, params *cloudformation.GetTemplateInput, optFns ...func(*cloudformation.Options)) (*cloudformation.GetTemplateOutput, error) {
+			return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(webTemplate)}, nil
+		},
+		ListStackResourcesFunc: func(ctx context.Context, params *cloudformation.ListStackResourcesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackResourcesOutput, error) {
+			return &cloudformation.ListStackResourcesOutput{StackResourceSummaries: []cftypes.StackResourceSummary{
+				{LogicalResourceId: aws.String("Bucket"), ResourceType: aws.String("AWS::S3::Bucket"), PhysicalResourceId: aws.String("web-bucket")},
+				{LogicalResourceId: aws.String("Queue"), ResourceType: aws.String("AWS::SQS::Queue"), PhysicalResourceId: aws.String("web-jobs")},
+			}}, nil
+		},
+	}
+}
+
+func TestDeleteStackDryRun(t *testing.T) {
+	out, err := runAWS(t, &fakeClients{cf: webStack(false)}, "delete-cf-stack", "web", "--dry-run")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Termination protection: disabled")
+	assert.Contains(t, out, "Bucket       AWS::S3::Bucket   web-bucket    Retain")
+	assert.Contains(t, out, "1 resources will be kept after deletion (DeletionPolicy Retain): Bucket")
+	assert.Contains(t, out, "Dry run: stack web would be deleted")
+}
+
+func TestDeleteStackRequiresConfirmation(t *testing.T) {
+	cf := webStack(false)
+	_, err := runAWSInput(t, &fakeClients{cf: cf}, "wbe\n", "delete-cf-stack", "web")
+	assert.Equal(t, clierr.KindAborted, clierr.KindOf(err))
+	assert.ErrorContains(t, err, "cancelled")
+
+	var deleted string
+	cf.DeleteStackFunc = func(ctx context.Context, params *cloudformation.DeleteStackInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteStackOutput, error) {
+		deleted = aws.ToString(params.StackName)
+		return &cloudformation.DeleteStackOutput{}, nil
+	}
+	out, err := runAWSInput(t, &fakeClients{cf: cf}, "web\n", "delete-cf-stack", "web")
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws:cloudformation:us-east-1:123456789012:stack/web/1", deleted)
+	assert.Contains(t, out, "Stack web deletion initiated")
+}
+
+func TestDeleteStackRefusesTerminationProtection(t *testing.T) {
+	_, err := runAWS(t, &fakeClients{cf: webStack(true)}, "delete-cf-stack", "web", "--yes")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+	assert.ErrorContains(t, err, "termination protection")
+}
+
+func TestDeleteStackWaitReportsFailedResources(t *testing.T) {
+	pollInterval = 0
+	cf := webStack(false)
+	describe := cf.DescribeStacksFunc
+	var deleted bool
+	cf.DeleteStackFunc = func(ctx context.Context, params *cloudformation.DeleteStackInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteStackOutput, error) {
+		deleted = true
+		return &cloudformation.DeleteStackOutput{}, nil
+	}
+	var polls int
+	cf.DescribeStacksFunc = func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+		out, _ := describe(ctx, params, optFns...)
+		if deleted {
+			polls++
+			out.Stacks[0].StackStatus = cftypes.StackStatusDeleteInProgress
+			if polls > 1 {
+				out.Stacks[0].StackStatus = cftypes.StackStatusDeleteFailed
+			}
+		}
+		return out, nil
+	}
+	event := func(id, logicalID string, status cftypes.ResourceStatus, reason string) cftypes.StackEvent {
+		return cftypes.StackEvent{EventId: aws.String(id), LogicalResourceId: aws.String(logicalID),
+			ResourceType: aws.String("AWS::SQS::Queue"), ResourceStatus: status,
+			ResourceStatusReason: aws.String(reason), Timestamp: aws.Time(time.Now())}
+	}
+	cf.DescribeStackEventsFunc = func(ctx context.Context, params *cloudformation.DescribeStackEventsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackEventsOutput, error) {
+		events := []cftypes.StackEvent{event("old", "web", cftypes.ResourceStatusUpdateComplete, "")}
+		if deleted {
+			events = append([]cftypes.StackEvent{event("e1", "Queue", cftypes.ResourceStatusDeleteInProgress, "")}, events...)
+		}
+		if polls > 1 {
+			events = append([]cftypes.StackEvent{
+				event("e3", "web", cftypes.ResourceStatusDeleteFailed, "The following resource(s) failed to delete: [Queue]"),
+				event("e2", "Queue", cftypes.ResourceStatusDeleteFailed, "Access denied"),
+			}, events...)
+		}
+		return &cloudformation.DescribeStackEventsOutput{StackEvents: events}, nil
+	}
+
+	out, err := runAWS(t, &fakeClients{cf: cf}, "delete-cf-stack", "web", "--yes", "--wait")
+	assert.Equal(t, clierr.KindRemote, clierr.KindOf(err))
+	assert.ErrorContains(t, err, "DELETE_FAILED")
+	assert.NotContains(t, out, "UPDATE_COMPLETE ")
+	assert.Regexp(t, `DELETE_IN_PROGRESS\s+Queue[\s\S]*DELETE_FAILED\s+Queue`, out)
+	assert.Contains(t, out, "Resources that failed to delete:\n  Queue (AWS::SQS::Queue): Access denied\n")
+}
+
+func TestReadParameters(t *testing.T) {
+	dir := t.TempDir()
+	cli := filepath.Join(dir, "cli.json")
+	os.WriteFile(cli, []byte(`[{"ParameterKey": "Env", "ParameterValue": "prod"}, {"ParameterKey": "Size", "ParameterValue": 3}]`), 0o644)
+	plain := filepath.Join(dir, "plain.yaml")
+	os.WriteFile(plain, []byte("Env: prod\nSize: 3\nSubnets: [a, b]\n"), 0o644)
+
+	values, err := readParameters(cli)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Env": "prod", "Size": "3"}, values)
+
+	values, err = readParameters(plain)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Env": "prod", "Size": "3", "Subnets": "a,b"}, values)
+}
+
+// deployStack serves an existing stack "web" and a change set replacing its bucket
+func deployStack(changes []cftypes.Change, reason string) (*mockCFClient, *cloudformation.CreateChangeSetInput) {
+	created := &cloudformation.CreateChangeSetInput{}
+	cf := &mockCFClient{
+		DescribeStacksFunc: func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+			return &cloudformation.DescribeStacksOutput{Stacks: []cftypes.Stack{{
+				StackName:   aws.String("web"),
+				StackStatus: cftypes.StackStatusUpdateComplete,
+				Parameters: []cftypes.Parameter{
+					{ParameterKey: aws.String("Env"), ParameterValue: aws.String("dev")},
+					{ParameterKey: aws.String("Size"), ParameterValue: aws.String("2")},
+					{ParameterKey: aws.String("Removed"), ParameterValue: aws.String("x")},
+				},
+			}}}, nil
+		},
+		CreateChangeSetFunc: func(ctx context.Context, params *cloudformation.CreateChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.CreateChangeSetOutput, error) {
+			*created = *params
+			return &cloudformation.CreateChangeSetOutput{Id: aws.String("cs-1")}, nil
+		},
+		DescribeChangeSetFunc: func(ctx context.Context, params *cloudformation.DescribeChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeChangeSetOutput, error) {
+			if reason != "" {
+				return &cloudformation.DescribeChangeSetOutput{Status: cftypes.ChangeSetStatusFailed, StatusReason: aws.String(reason)}, nil
+			}
+			return &cloudformation.DescribeChangeSetOutput{Status: cftypes.ChangeSetStatusCreateComplete, Changes: changes}, nil
+		},
+		ExecuteChangeSetFunc: func(ctx context.Context, params *cloudformation.ExecuteChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ExecuteChangeSetOutput, error) {
+			return &cloudformation.ExecuteChangeSetOutput{}, nil
+		},
+		DescribeStackEventsFunc: func(ctx context.Context, params *cloudformation.DescribeStackEventsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackEventsOutput, error) {
+			return &cloudformation.DescribeStackEventsOutput{}, nil
+		},
+	}
+	return cf, created
+}
+
+func TestDeployStackPreviewsAndExecutesChangeSet(t *testing.T) {
+	pollInterval = 0
+	dir := t.TempDir()
+	template := filepath.Join(dir, "web.yaml")
+	os.WriteFile(template, []byte("Parameters:\n  Env:\n    Type: String\n  Size:\n    Type: Number\nResources: {}\n"), 0o644)
+	params := filepath.Join(dir, "prod.json")
+	os.WriteFile(params, []byte(`{"Env": "prod"}`), 0o644)
+
+	cf, created := deployStack([]cftypes.Change{{ResourceChange: &cftypes.ResourceChange{
+		Action:            cftypes.ChangeActionModify,
+		LogicalResourceId: aws.String("Bucket"),
+		ResourceType:      aws.String("AWS::S3::Bucket"),
+		Replacement:       cftypes.ReplacementTrue,
+		Details: []cftypes.ResourceChangeDetail{{Target: &cftypes.ResourceTargetDefinition{
+			Attribute: cftypes.ResourceAttributeProperties, Name: aws.String("BucketName"),
+		}}},
+	}}}, "")
+
+	out, err := runAWSInput(t, &fakeClients{cf: cf}, "y\n", "deploy-cf-stack", "web", "-t", template, "-p", params)
+	assert.NoError(t, err)
+	assert.Equal(t, cftypes.ChangeSetTypeUpdate, created.ChangeSetType)
+	assert.Equal(t, []cftypes.Parameter{
+		{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+		{ParameterKey: aws.String("Size"), UsePreviousValue: aws.Bool(true)},
+	}, created.Parameters)
+	assert.Regexp(t, `~ Modify\s+Bucket\s+AWS::S3::Bucket\s+⚠️ yes\s+BucketName`, out)
+	assert.Contains(t, out, "Stack web deployed (UPDATE_COMPLETE)")
+}
+
+func TestDeployStackWithoutChanges(t *testing.T) {
+	pollInterval = 0
+	template := filepath.Join(t.TempDir(), "web.yaml")
+	os.WriteFile(template, []byte("Resources: {}\n"), 0o644)
+
+	cf, _ := deployStack(nil, "The submitted information didn't contain changes.")
+	var deleted bool
+	cf.DeleteChangeSetFunc = func(ctx context.Context, params *cloudformation.DeleteChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteChangeSetOutput, error) {
+		deleted = true
+		return &cloudformation.DeleteChangeSetOutput{}, nil
+	}
+
+	out, err := runAWS(t, &fakeClients{cf: cf}, "deploy-cf-stack", "web", "-t", template)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Contains(t, out, "Stack web is up to date")
+}
+
+func TestDeployStackRefusesRollbackComplete(t *testing.T) {
+	template := filepath.Join(t.TempDir(), "web.yaml")
+	os.WriteFile(template, []byte("Resources: {}\n"), 0o644)
+
+	cf, _ := deployStack(nil, "")
+	cf.DescribeStacksFunc = func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+		return &cloudformation.DescribeStacksOutput{Stacks: []cftypes.Stack{{
+			StackName: aws.String("web"), StackStatus: cftypes.StackStatusRollbackComplete,
+		}}}, nil
+	}
+
+	_, err := runAWS(t, &fakeClients{cf: cf}, "deploy-cf-stack", "web", "-t", template)
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+	assert.ErrorContains(t, err, "delete-cf-stack web")
+}
+
+func TestDeployStackDeclined(t *testing.T) {
+	pollInterval = 0
+	template := filepath.Join(t.TempDir(), "web.yaml")
+	os.WriteFile(template, []byte("Resources: {}\n"), 0o644)
+
+	cf, _ := deployStack([]cftypes.Change{{ResourceChange: &cftypes.ResourceChange{
+		Action: cftypes.ChangeActionAdd, LogicalResourceId: aws.String("Queue"), ResourceType: aws.String("AWS::SQS::Queue"),
+	}}}, "")
+	var deleted bool
+	cf.DeleteChangeSetFunc = func(ctx context.Context, params *cloudformation.DeleteChangeSetInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DeleteChangeSetOutput, error) {
+		deleted = true
+		return &cloudformation.DeleteChangeSetOutput{}, nil
+	}
+
+	_, err := runAWSInput(t, &fakeClients{cf: cf}, "n\n", "deploy-cf-stack", "web", "-t", template)
+	assert.Equal(t, clierr.KindAborted, clierr.KindOf(err))
+	assert.True(t, deleted)
+}
+
+func TestStackEventsIgnoresPastFailures(t *testing.T) {
+	pollInterval = 0
+	event := func(id string, status cftypes.ResourceStatus) cftypes.StackEvent {
+		return cftypes.StackEvent{EventId: aws.String(id), StackId: aws.String("stack/web/1"),
+			LogicalResourceId: aws.String("Queue"), PhysicalResourceId: aws.String("queue-1"),
+			ResourceType: aws.String("AWS::SQS::Queue"), ResourceStatus: status, Timestamp: aws.Time(time.Now())}
+	}
+	cf := &mockCFClient{
+		DescribeStacksFunc: func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+			return &cloudformation.DescribeStacksOutput{Stacks: []cftypes.Stack{{StackName: aws.String("web"), StackStatus: cftypes.StackStatusUpdateComplete}}}, nil
+		},
+		DescribeStackEventsFunc: func(ctx context.Context, params *cloudformation.DescribeStackEventsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackEventsOutput, error) {
+			return &cloudformation.DescribeStackEventsOutput{StackEvents: []cftypes.StackEvent{
+				event("e3", cftypes.ResourceStatusUpdateComplete),
+				event("e2", cftypes.ResourceStatusUpdateFailed),
+				event("e1", cftypes.ResourceStatusUpdateInProgress),
+			}}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{cf: cf}, "cf-events", "web")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "UPDATE_FAILED")
+
+	_, err = runAWS(t, &fakeClients{cf: cf}, "cf-events", "web", "-n", "-1")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestStackEventsFollowsNestedStacks(t *testing.T) {
+	pollInterval = 0
+	const parentID, childID = "stack/web/1", "stack/web-Network/2"
+	event := func(id, stackID, logicalID, physicalID, resourceType string, status cftypes.ResourceStatus) cftypes.StackEvent {
+		return cftypes.StackEvent{EventId: aws.String(id), StackId: aws.String(stackID),
+			LogicalResourceId: aws.String(logicalID), PhysicalResourceId: aws.String(physicalID),
+			ResourceType: aws.String(resourceType), ResourceStatus: status, Timestamp: aws.Time(time.Now())}
+	}
+
+	var polls int
+	cf := &mockCFClient{
+		DescribeStacksFunc: func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+			polls++
+			status := cftypes.StackStatusUpdateInProgress
+			if polls > 2 {
+				status = cftypes.StackStatusUpdateRollbackComplete
+			}
+			return &cloudformation.DescribeStacksOutput{Stacks: []cftypes.Stack{{StackName: aws.String("web"), StackStatus: status}}}, nil
+		},
+		DescribeStackEventsFunc: func(ctx context.Context, params *cloudformation.DescribeStackEventsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackEventsOutput, error) {
+			var events []cftypes.StackEvent
+			switch aws.ToString(params.StackName) {
+			case "web":
+				events = []cftypes.StackEvent{
+					event("p2", parentID, "web", parentID, "AWS::CloudFormation::Stack", cftypes.ResourceStatusUpdateInProgress),
+					event("p1", parentID, "web", parentID, "AWS::CloudFormation::Stack", cftypes.ResourceStatusUpdateComplete),
+				}
+				if polls > 0 {
+					events = append([]cftypes.StackEvent{
+						event("p3", parentID, "Network", childID, "AWS::CloudFormation::Stack", cftypes.ResourceStatusUpdateInProgress),
+					}, events...)
+				}
+			case childID:
+				events = []cftypes.StackEvent{
+					event("c2", childID, "Subnet", "subnet-1", "AWS::EC2::Subnet", cftypes.ResourceStatusUpdateFailed),
+					event("c1", childID, "web-Network", childID, "AWS::CloudFormation::Stack", cftypes.ResourceStatusUpdateInProgress),
+				}
+			}
+			return &cloudformation.DescribeStackEventsOutput{StackEvents: events}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{cf: cf}, "cf-events", "web", "--nested", "--lines", "1")
+	assert.Equal(t, clierr.KindCheckFailed, clierr.KindOf(err))
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `UPDATE_IN_PROGRESS\s+web\s`, lines[0])
+	assert.Regexp(t, `UPDATE_IN_PROGRESS\s+▸ Network\s+AWS::CloudFormation::Stack`, lines[1])
+	assert.Regexp(t, `UPDATE_FAILED\s+Network/Subnet\s+AWS::EC2::Subnet`, lines[2])
+}
+
+func TestStackEventsFollow(t *testing.T) {
+	pollInterval = 0
+	var polls atomic.Int32
+	var failAt int32
+	event := func(id string, status cftypes.ResourceStatus) cftypes.StackEvent {
+		return cftypes.StackEvent{EventId: aws.String(id), StackId: aws.String("stack/web/1"),
+			LogicalResourceId: aws.String("Queue"), PhysicalResourceId: aws.String("queue-1"),
+			ResourceType: aws.String("AWS::SQS::Queue"), ResourceStatus: status, Timestamp: aws.Time(time.Now())}
+	}
+	cf := &mockCFClient{
+		DescribeStacksFunc: func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+			n := polls.Add(1)
+			status := cftypes.StackStatusUpdateComplete
+			if failAt > 0 && n > failAt && n <= failAt+2 {
+				status = cftypes.StackStatusUpdateRollbackInProgress
+			}
+			return &cloudformation.DescribeStacksOutput{Stacks: []cftypes.Stack{{StackName: aws.String("web"), StackStatus: status}}}, nil
+		},
+		DescribeStackEventsFunc: func(ctx context.Context, params *cloudformation.DescribeStackEventsInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStackEventsOutput, error) {
+			events := []cftypes.StackEvent{event("e1", cftypes.ResourceStatusUpdateComplete)}
+			if failAt > 0 && polls.Load() > failAt {
+				events = append([]cftypes.StackEvent{event("e2", cftypes.ResourceStatusUpdateFailed)}, events...)
+			}
+			return &cloudformation.DescribeStackEventsOutput{StackEvents: events}, nil
+		},
+	}
+
+	// a failure while following ends the watch with code 7
+	failAt = 3
+	out, err := runAWS(t, &fakeClients{cf: cf}, "cf-events", "web", "--follow")
+	assert.Equal(t, clierr.KindCheckFailed, clierr.KindOf(err))
+	assert.Contains(t, out, "UPDATE_FAILED")
+
+	// an interrupt without failures is a clean stop
+	polls.Store(0)
+	failAt = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := newAwsHelperCmd(&fakeClients{cf: cf})
+	printer.AddFlag(cmd.PersistentFlags())
+	cmd.SilenceUsage, cmd.SilenceErrors = true, true
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs([]string{"cf-events", "web", "--follow"})
+	go func() {
+		for polls.Load() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	assert.NoError(t, cmd.ExecuteContext(ctx))
+}
+
+func TestListStacksFilters(t *testing.T) {
+	var filter []cftypes.StackStatus
+	cf := &mockCFClient{
+		ListStacksFunc: func(ctx context.Context, params *cloudformation.ListStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStacksOutput, error) {
+			filter = params.StackStatusFilter
+			return &cloudformation.ListStacksOutput{StackSummaries: []cftypes.StackSummary{
+				{StackName: aws.String("web-api"), StackStatus: cftypes.StackStatusUpdateRollbackComplete},
+				{StackName: aws.String("db"), StackStatus: cftypes.StackStatusCreateFailed},
+			}}, nil
+		},
+		DescribeStacksFunc: func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+			return &cloudformation.DescribeStacksOutput{Stacks: []cftypes.Stack{
+				{StackName: aws.String("web-api"), StackStatus: cftypes.StackStatusUpdateComplete, Tags: []cftypes.Tag{{Key: aws.String("team"), Value: aws.String("web")}}},
+				{StackName: aws.String("web-jobs"), StackStatus: cftypes.StackStatusUpdateComplete, Tags: []cftypes.Tag{{Key: aws.String("team"), Value: aws.String("data")}}},
+			}}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{cf: cf}, "list-cf-stacks", "--failed", "--name", "web-*", "-o", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "web-api\n", out)
+	assert.Contains(t, filter, cftypes.StackStatusCreateFailed)
+	assert.Contains(t, filter, cftypes.StackStatusUpdateRollbackComplete)
+	assert.NotContains(t, filter, cftypes.StackStatusUpdateComplete)
+
+	out, err = runAWS(t, &fakeClients{cf: cf}, "list-cf-stacks", "--tag", "team=data", "-o", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "web-jobs\n", out)
+
+	_, err = runAWS(t, &fakeClients{cf: cf}, "list-cf-stacks", "--status", "BROKEN")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+
+	// flags narrow each other instead of adding statuses
+	_, err = runAWS(t, &fakeClients{cf: cf}, "list-cf-stacks", "--failed", "--status", "create_failed,UPDATE_COMPLETE")
+	assert.NoError(t, err)
+	assert.Equal(t, []cftypes.StackStatus{cftypes.StackStatusCreateFailed}, filter)
+
+	_, err = runAWS(t, &fakeClients{cf: cf}, "list-cf-stacks", "--failed", "--status", "CREATE_COMPLETE")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestDescribeStack(t *testing.T) {
+	cf := &mockCFClient{
+		DescribeStacksFunc: func(ctx context.Context, params *cloudformation.DescribeStacksInput, optFns ...func(*cloudformation.Options)) (*cloudformation.DescribeStacksOutput, error) {
+			return &cloudformation.DescribeStacksOutput{Stacks: []cftypes.Stack{{
+				StackName:        aws.String("web"),
+				StackStatus:      cftypes.StackStatusUpdateComplete,
+				Parameters:       []cftypes.Parameter{{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")}},
+				Outputs:          []cftypes.Output{{OutputKey: aws.String("Url"), OutputValue: aws.String("https://web"), ExportName: aws.String("web-url")}},
+				Tags:             []cftypes.Tag{{Key: aws.String("team"), Value: aws.String("web")}},
+				DriftInformation: &cftypes.StackDriftInformation{StackDriftStatus: cftypes.StackDriftStatusInSync},
+			}}}, nil
+		},
+		ListStackResourcesFunc: func(ctx context.Context, params *cloudformation.ListStackResourcesInput, optFns ...func(*cloudformation.Options)) (*cloudformation.ListStackResourcesOutput, error) {
+			return &cloudformation.ListStackResourcesOutput{StackResourceSummaries: []cftypes.StackResourceSummary{
+				{LogicalResourceId: aws.String("Bucket"), ResourceType: aws.String("AWS::S3::Bucket")},
+				{LogicalResourceId: aws.String("Network"), ResourceType: aws.String("AWS::CloudFormation::Stack"),
+					PhysicalResourceId: aws.String("stack/web-Network/2"), ResourceStatus: cftypes.ResourceStatusUpdateComplete},
+			}}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{cf: cf}, "describe-cf-stack", "web")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Drift:                   IN_SYNC")
+	assert.Regexp(t, `Env\s+prod`, out)
+	assert.Regexp(t, `Url\s+https://web\s+\(export: web-url\)`, out)
+	assert.Regexp(t, `team\s+web`, out)
+	assert.Regexp(t, `Network\s+UPDATE_COMPLETE\s+stack/web-Network/2`, out)
+	assert.NotContains(t, out, "Bucket")
+
+	out, err = runAWS(t, &fakeClients{cf: cf}, "describe-cf-stack", "web", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"nestedStacks"`)
+	assert.Contains(t, out, `"Env": "prod"`)
+}
+
+func TestS3PutGetAndCopy(t *testing.T) {
+	store := newMemS3(nil)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "report.csv")
+	assert.NoError(t, os.WriteFile(src, []byte("a,b\n1,2\n"), 0o644))
+
+	out, err := runAWS(t, &fakeClients{s3: store}, "s3", "put", src, "s3://data/reports/")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "s3://data/reports/report.csv")
+
+	_, err = runAWS(t, &fakeClients{s3: store}, "s3", "cp", "s3://data/reports/report.csv", "s3://archive/2024/")
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b\n1,2\n", string(store.objects["archive/2024/report.csv"]))
+
+	dest := filepath.Join(dir, "copy.csv")
+	_, err = runAWS(t, &fakeClients{s3: store}, "s3", "get", "s3://archive/2024/report.csv", dest)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b\n1,2\n", string(data))
+
+	out, err = runAWS(t, &fakeClients{s3: store}, "s3", "get", "s3://archive/2024/report.csv", "-")
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b\n1,2\n", out)
+
+	_, err = runAWS(t, &fakeClients{s3: store}, "s3", "get", "s3://archive/missing.csv", dest)
+	assert.Equal(t, clierr.KindNotFound, clierr.KindOf(err))
+}
+
+func TestS3RemovePrefixRequiresConfirmation(t *testing.T) {
+	store := newMemS3(map[string]string{"data/tmp/a": "1", "data/tmp/b": "2", "data/keep": "3"})
+
+	_, err := runAWS(t, &fakeClients{s3: store}, "s3", "rm", "s3://data/tmp/")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+
+	out, err := runAWSInput(t, &fakeClients{s3: store}, "n\n", "s3", "rm", "s3://data/tmp/", "--recursive")
+	assert.Equal(t, clierr.KindAborted, clierr.KindOf(err))
+	assert.Contains(t, out, "s3://data/tmp/b")
+	assert.Len(t, store.objects, 3)
+
+	out, err = runAWSInput(t, &fakeClients{s3: store}, "y\n", "s3", "rm", "s3://data/tmp/", "--recursive")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Deleted 2 objects")
+	assert.Equal(t, []string{"data/keep"}, slices.Collect(maps.Keys(store.objects)))
+}
+
+func TestS3SyncTransfersOnlyDifferences(t *testing.T) {
+	store := newMemS3(map[string]string{"site/old.txt": "stale"})
+	dir := t.TempDir()
+	big := bytes.Repeat([]byte("0123456789abcdef"), 11<<16) // 11 MiB, uploaded in 3 parts
+	files := map[string][]byte{"index.html": []byte("<h1>hi</h1>"), "css/app.css": []byte("body{}"), "big.bin": big}
+	for name, data := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+
+	out, err := runAWS(t, &fakeClients{s3: store}, "s3", "sync", dir, "s3://site")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Uploaded 3 files")
+	assert.Equal(t, big, store.objects["site/big.bin"])
+	assert.Contains(t, store.multipart["site/big.bin"], "-3\"")
+
+	// same size, different content: only the ETag tells them apart
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>ho</h1>"), 0o644))
+	store.puts = nil
+	out, err = runAWS(t, &fakeClients{s3: store}, "s3", "sync", dir, "s3://site/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"index.html"}, store.puts)
+	assert.Contains(t, out, "upload index.html (content differs)")
+	assert.Contains(t, out, "2 were up to date")
+
+	out, err = runAWS(t, &fakeClients{s3: store}, "s3", "sync", dir, "s3://site/", "--dry-run")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Nothing to upload; 3 files are up to date")
+
+	restore := filepath.Join(t.TempDir(), "restore")
+	out, err = runAWS(t, &fakeClients{s3: store}, "s3", "sync", "s3://site/", restore)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Downloaded 4 files")
+	data, err := os.ReadFile(filepath.Join(restore, "big.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, big, data)
+
+	out, err = runAWS(t, &fakeClients{s3: store}, "s3", "sync", "s3://site/", restore)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Nothing to download; 4 files are up to date")
+}
+
+func TestS3SyncSkipsKeysOutsideTheDirectory(t *testing.T) {
+	store := newMemS3(map[string]string{
+		"site/index.html":                 "<h1>hi</h1>",
+		"site/../../.ssh/authorized_keys": "ssh-ed25519 AAAA",
+		"site/assets/../../escape.txt":    "out",
+		"site/assets/../assets/app.css":   "body{}",
+	})
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "restore")
+
+	out, err := runAWS(t, &fakeClients{s3: store}, "s3", "sync", "s3://site/", dir)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Downloaded 2 files")
+	assert.FileExists(t, filepath.Join(dir, "index.html"))
+	assert.FileExists(t, filepath.Join(dir, "assets", "app.css"))
+	assert.NoFileExists(t, filepath.Join(root, ".ssh", "authorized_keys"))
+	assert.NoFileExists(t, filepath.Join(root, "a", "escape.txt"))
+}
+
+func TestS3Presign(t *testing.T) {
+	presign := s3.NewPresignClient(s3.New(s3.Options{
+		Region:      "eu-west-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", ""),
+	}))
+
+	out, err := runAWS(t, &fakeClients{presign: presign}, "s3", "presign", "builds/app/1.4.2.tar.gz", "--expires", "24h")
+	assert.NoError(t, err)
+	u, err := url.Parse(strings.TrimSpace(out))
+	assert.NoError(t, err)
+	assert.Equal(t, "builds.s3.eu-west-1.amazonaws.com", u.Host)
+	assert.Equal(t, "/app/1.4.2.tar.gz", u.Path)
+	assert.Equal(t, "86400", u.Query().Get("X-Amz-Expires"))
+
+	out, err = runAWS(t, &fakeClients{presign: presign}, "s3", "presign", "s3://builds/app/next.tar.gz", "--method", "put")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "X-Amz-Expires=3600")
+
+	_, err = runAWS(t, &fakeClients{presign: presign}, "s3", "presign", "builds/app.tar.gz", "--expires", "200h")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+	_, err = runAWS(t, &fakeClients{presign: presign}, "s3", "presign", "builds/app/")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestS3Head(t *testing.T) {
+	retain := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockClient := &mockS3Client{
+		HeadObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			assert.Equal(t, "q1.csv", aws.ToString(params.Key))
+			return &s3.HeadObjectOutput{
+				ContentLength:             aws.Int64(2048),
+				ETag:                      aws.String(`"abc"`),
+				ServerSideEncryption:      types.ServerSideEncryptionAwsKms,
+				SSEKMSKeyId:               aws.String("arn:aws:kms:eu-west-1:111122223333:key/k1"),
+				VersionId:                 aws.String("v2"),
+				ObjectLockMode:            types.ObjectLockModeCompliance,
+				ObjectLockRetainUntilDate: &retain,
+				Metadata:                  map[string]string{"build": "1742"},
+			}, nil
+		},
+		GetObjectTaggingFunc: func(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{TagSet: []types.Tag{{Key: aws.String("team"), Value: aws.String("audit")}}}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{s3: mockClient}, "s3", "head", "audit/q1.csv")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Storage class:  STANDARD")
+	assert.Contains(t, out, "aws:kms (arn:aws:kms:eu-west-1:111122223333:key/k1)")
+	assert.Contains(t, out, "COMPLIANCE until 2030-01-01T00:00:00Z")
+	assert.Contains(t, out, "team")
+	assert.Contains(t, out, "build")
+
+	out, err = runAWS(t, &fakeClients{s3: mockClient}, "s3", "head", "audit/q1.csv", "-o", "json")
+	assert.NoError(t, err)
+	var detail []objectDetail
+	assert.NoError(t, json.Unmarshal([]byte(out), &detail))
+	assert.Equal(t, map[string]string{"team": "audit"}, detail[0].Tags)
+	assert.Equal(t, "v2", detail[0].VersionID)
+}
+
+func TestS3Audit(t *testing.T) {
+	out, err := runAWS(t, &fakeClients{s3: auditS3{}}, "s3", "audit", "-o", "json")
+	assert.Equal(t, clierr.KindCheckFailed, clierr.KindOf(err))
+	assert.EqualError(t, err, "1 of 2 buckets failed the audit")
+
+	var results []auditResult
+	assert.NoError(t, json.Unmarshal([]byte(out), &results))
+	status := map[string]string{}
+	for _, r := range results {
+		status[r.Bucket+" "+r.Check] = r.Status
+	}
+	assert.Equal(t, map[string]string{
+		"locked public-access-block": "pass", "locked policy": "pass", "locked acl": "pass", "locked encryption": "pass",
+		"locked versioning": "pass", "locked logging": "pass", "locked lifecycle": "pass",
+		"open public-access-block": "fail", "open policy": "fail", "open acl": "fail", "open encryption": "fail",
+		"open versioning": "warn", "open logging": "warn", "open lifecycle": "warn",
+	}, status)
+	assert.Contains(t, out, "Allows any principal: PublicRead")
+	assert.Contains(t, out, "Grants AllUsers READ")
+	assert.Contains(t, out, "Could not check: AccessDenied")
+
+	out, err = runAWS(t, &fakeClients{s3: auditS3{}}, "s3", "audit", "locked")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "1 buckets: 7 pass, 0 warn, 0 fail")
+
+	_, err = runAWS(t, &fakeClients{s3: auditS3{}}, "s3", "audit", "missing")
+	assert.Equal(t, clierr.KindCheckFailed, clierr.KindOf(err))
+}
+
+func TestDisplayBucketPolicy(t *testing.T) {
+	mockClient := &mockS3Client{
+		GetBucketPolicyFunc: func(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+			return &s3.GetBucketPolicyOutput{Policy: aws.String(`{"Version":"2012-10-17","Statement":[{"Sid":"PublicRead",` +
+				`"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::site/*"}]}`)}, nil
+		},
+	}
+
+	out, err := runAWS(t, &fakeClients{s3: mockClient}, "display-bucket-policy", "site")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "🪣 Bucket Policy for site:\n{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": [\n    {\n      \"Sid\": \"PublicRead\",")
+
+	out, err = runAWS(t, &fakeClients{s3: mockClient}, "display-bucket-policy", "site", "--explain")
+	assert.NoError(t, err)
+	assert.Equal(t, "Statement 1 (PublicRead): Anyone can s3:GetObject on arn:aws:s3:::site/*.\n"+
+		"  ⚠️ Any principal, including anonymous users\n", out)
+
+	out, err = runAWS(t, &fakeClients{s3: mockClient}, "display-bucket-policy", "site", "--explain", "-o", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"warnings": [`)
+}
+
+func TestExplainPoliciesWithNonStringConditions(t *testing.T) {
+	s3Client := &mockS3Client{
+		GetBucketPolicyFunc: func(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+			return &s3.GetBucketPolicyOutput{Policy: aws.String(`{"Statement":[{"Sid":"TLSOnly","Effect":"Deny","Principal":"*",` +
+				`"Action":"s3:*","Resource":"arn:aws:s3:::site/*","Condition":{"Bool":{"aws:SecureTransport":false}}}]}`)}, nil
+		},
+	}
+	out, err := runAWS(t, &fakeClients{s3: s3Client}, "display-bucket-policy", "site", "--explain")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Statement 1 (TLSOnly): Anyone cannot s3:* on arn:aws:s3:::site/* when aws:SecureTransport is false.\n")
+
+	iamClient := &mockIAMClient{
+		GetRoleFunc: func(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+			return &iam.GetRoleOutput{Role: &iamtypes.Role{Arn: aws.String("arn:aws:iam::111122223333:role/deploy")}}, nil
+		},
+		ListAttachedRolePoliciesFunc: func(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+			return &iam.ListAttachedRolePoliciesOutput{}, nil
+		},
+		ListRolePoliciesFunc: func(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+			return &iam.ListRolePoliciesOutput{PolicyNames: []string{"short-sessions"}}, nil
+		},
+		GetRolePolicyFunc: func(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+			return &iam.GetRolePolicyOutput{PolicyDocument: aws.String(url.PathEscape(`{"Statement":[{"Sid":"Recent","Effect":"Allow",` +
+				`"Action":"ec2:*","Resource":"*","Condition":{"NumericLessThan":{"aws:MultiFactorAuthAge":3600}}}]}`))}, nil
+		},
+	}
+	out, err = runAWS(t, &fakeClients{iam: iamClient}, "iam", "policies", "role/deploy", "--explain")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "when aws:MultiFactorAuthAge is less than 3600.\n")
+}
+
+func TestListBucketObjectsFolders(t *testing.T) {
+	store := newMemS3(map[string]string{
+		"data/logs/readme.txt":    "hello",
+		"data/logs/2024/01/a.log": strings.Repeat("a", 2048),
+		"data/logs/2024/02/b.log": strings.Repeat("b", 1024),
+		"data/logs/2023/12/c.log": "c",
+		"data/logs/2023/12/d.log": "dd",
+		"data/other/ignored.txt":  "x",
+	})
+
+	out, err := runAWS(t, &fakeClients{s3: store}, "list-bucket-objects", "data", "--prefix", "logs/", "-o", "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "logs/2023/\nlogs/2024/\nlogs/readme.txt\n", out)
+
+	out, err = runAWS(t, &fakeClients{s3: store}, "list-bucket-objects", "data", "--prefix", "logs/2024/", "--recursive")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "logs/2024/01/a.log")
+	assert.Contains(t, out, "2.0 KiB")
+	assert.NotContains(t, out, "PRE")
+
+	out, err = runAWS(t, &fakeClients{s3: store}, "list-bucket-objects", "data", "--prefix", "logs/", "--du", "-o", "json")
+	assert.NoError(t, err)
+	var usage []usageRecord
+	assert.NoError(t, json.Unmarshal([]byte(out), &usage))
+	assert.Equal(t, []usageRecord{
+		{Prefix: "logs/2024/", Objects: 2, Size: 3072},
+		{Prefix: "logs/", Objects: 1, Size: 5},
+		{Prefix: "logs/2023/", Objects: 2, Size: 3},
+	}, usage)
+
+	out, err = runAWS(t, &fakeClients{s3: store}, "list-bucket-objects", "data", "--prefix", "logs/", "--du")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Total: 5 objects, 3.0 KiB in s3://data/logs/")
+
+	_, err = runAWS(t, &fakeClients{s3: store}, "list-bucket-objects", "data", "--du", "--max-items", "5")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+// deployRole is a role with one managed and one inline policy, both URL
+// encoded as IAM returns them
+func deployRole(t *testing.T, decision iamtypes.PolicyEvaluationDecisionType, matched ...iamtypes.Statement) *mockIAMClient {
+	return &mockIAMClient{
+		GetRoleFunc: func(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+			return &iam.GetRoleOutput{Role: &iamtypes.Role{Arn: aws.String("arn:aws:iam::111122223333:role/ci/" + aws.ToString(params.RoleName))}}, nil
+		},
+		ListAttachedRolePoliciesFunc: func(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+			return &iam.ListAttachedRolePoliciesOutput{AttachedPolicies: []iamtypes.AttachedPolicy{{
+				PolicyName: aws.String("BuildsWriter"),
+				PolicyArn:  aws.String("arn:aws:iam::111122223333:policy/BuildsWriter"),
+			}}}, nil
+		},
+		GetPolicyFunc: func(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+			return &iam.GetPolicyOutput{Policy: &iamtypes.Policy{DefaultVersionId: aws.String("v3")}}, nil
+		},
+		GetPolicyVersionFunc: func(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+			assert.Equal(t, "v3", aws.ToString(params.VersionId))
+			return &iam.GetPolicyVersionOutput{PolicyVersion: &iamtypes.PolicyVersion{Document: aws.String(url.PathEscape(
+				"{\n\"Version\": \"2012-10-17\",\n\"Statement\": [\n{\"Sid\": \"Builds\", \"Effect\": \"Allow\", \"Action\": \"s3:*\", \"Resource\": \"arn:aws:s3:::builds/*\"}\n]\n}"))}}, nil
+		},
+		ListRolePoliciesFunc: func(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+			return &iam.ListRolePoliciesOutput{PolicyNames: []string{"guardrails"}}, nil
+		},
+		GetRolePolicyFunc: func(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+			return &iam.GetRolePolicyOutput{PolicyDocument: aws.String(url.PathEscape(
+				"{\n\"Version\": \"2012-10-17\",\n\"Statement\": [\n{\"Sid\": \"Builds\", \"Effect\": \"Allow\", \"Action\": \"s3:GetObject\", \"Resource\": \"*\"},\n" +
+					"{\"Sid\": \"NoReleases\", \"Effect\": \"Deny\", \"Action\": \"s3:PutObject\", \"Resource\": \"arn:aws:s3:::builds/releases/*\"}\n]\n}"))}, nil
+		},
+		SimulatePrincipalPolicyFunc: func(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+			assert.Equal(t, "arn:aws:iam::111122223333:role/ci/deploy", aws.ToString(params.PolicySourceArn))
+			return &iam.SimulatePrincipalPolicyOutput{EvaluationResults: []iamtypes.EvaluationResult{{
+				EvalActionName:    aws.String(params.ActionNames[0]),
+				EvalDecision:      decision,
+				MatchedStatements: matched,
+			}}}, nil
+		},
+	}
+}
+
+func TestIAMPolicies(t *testing.T) {
+	client := deployRole(t, iamtypes.PolicyEvaluationDecisionTypeAllowed)
+
+	out, err := runAWS(t, &fakeClients{iam: client}, "iam", "policies", "role/deploy")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "📜 Managed policy BuildsWriter (v3):\n{\n  \"Version\": \"2012-10-17\",")
+	assert.Contains(t, out, "\n\n📜 Inline policy guardrails:\n")
+
+	out, err = runAWS(t, &fakeClients{iam: client}, "iam", "policies", "arn:aws:sts::111122223333:assumed-role/deploy/ci", "--explain")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Statement 1 (Builds): The attached identity can s3:* on arn:aws:s3:::builds/*.\n  ⚠️ Wildcard action s3:*\n")
+	assert.Contains(t, out, "Statement 2 (NoReleases): The attached identity cannot s3:PutObject on arn:aws:s3:::builds/releases/*.\n")
+
+	out, err = runAWS(t, &fakeClients{iam: client}, "iam", "policies", "role/deploy", "-o", "json")
+	assert.NoError(t, err)
+	var docs []policyDocument
+	assert.NoError(t, json.Unmarshal([]byte(out), &docs))
+	assert.Len(t, docs, 2)
+	assert.Equal(t, "inline", docs[1].Type)
+	assert.Contains(t, string(docs[1].Document), `"NoReleases"`)
+
+	_, err = runAWS(t, &fakeClients{iam: client}, "iam", "policies", "bucket/deploy")
+	assert.Equal(t, clierr.KindInput, clierr.KindOf(err))
+}
+
+func TestIAMCan(t *testing.T) {
+	denied := deployRole(t, iamtypes.PolicyEvaluationDecisionTypeExplicitDeny, iamtypes.Statement{
+		SourcePolicyId:   aws.String("role_deploy_guardrails"),
+		SourcePolicyType: iamtypes.PolicySourceTypeRole,
+		StartPosition:    &iamtypes.Position{Line: 5, Column: 1},
+	})
+	out, err := runAWS(t, &fakeClients{iam: denied}, "iam", "can", "role/deploy", "s3:PutObject", "arn:aws:s3:::builds/releases/1.0.tar.gz")
+	assert.Equal(t, clierr.KindCheckFailed, clierr.KindOf(err))
+	assert.Contains(t, out, "Decision:   explicitDeny\n")
+	assert.Contains(t, out, "Statement NoReleases at line 5 of role policy guardrails\n"+
+		"  The attached identity cannot s3:PutObject on arn:aws:s3:::builds/releases/*.\n")
+
+	allowed := deployRole(t, iamtypes.PolicyEvaluationDecisionTypeAllowed, iamtypes.Statement{
+		SourcePolicyId:   aws.String("BuildsWriter"),
+		SourcePolicyType: iamtypes.PolicySourceTypeUser,
+		StartPosition:    &iamtypes.Position{Line: 4, Column: 1},
+	})
+	out, err = runAWS(t, &fakeClients{iam: allowed}, "iam", "can", "role/deploy", "s3:PutObject", "arn:aws:s3:::builds/app.tar.gz", "-o", "json")
+	assert.NoError(t, err)
+	var decisions []accessDecision
+	assert.NoError(t, json.Unmarshal([]byte(out), &decisions))
+	assert.Equal(t, "allowed", decisions[0].Decision)
+	assert.Equal(t, "Builds", decisions[0].Statements[0].Sid)
+	assert.Equal(t, "BuildsWriter", decisions[0].Statements[0].Policy)
+
+	implicit := deployRole(t, iamtypes.PolicyEvaluationDecisionTypeImplicitDeny)
+	out, err = runAWS(t, &fakeClients{iam: implicit}, "iam", "can", "role/deploy", "ec2:StopInstances", "*")
+	assert.Equal(t, clierr.KindCheckFailed, clierr.KindOf(err))
+	assert.Contains(t, out, "No statement allows it")
+}
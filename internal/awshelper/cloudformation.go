@@ -0,0 +1,554 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"devctl/pkg/prompt"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/spf13/cobra"
+)
+
+type stackRecord struct {
+	origin
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Created     *time.Time `json:"created,omitempty"`
+	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+	StackID     string     `json:"stackId,omitempty"`
+}
+
+var stackColumns = []printer.Column[stackRecord]{
+	{Header: "Name", Value: func(s stackRecord) string { return s.Name }},
+	{Header: "Status", Value: func(s stackRecord) string { return s.Status }},
+	{Header: "Created", Wide: true, Value: func(s stackRecord) string { return printer.Time(s.Created) }},
+	{Header: "Last Updated", Wide: true, Value: func(s stackRecord) string { return printer.Time(s.LastUpdated) }},
+}
+
+func newStackRecord(s cftypes.Stack) stackRecord {
+	return stackRecord{
+		Name:        aws.ToString(s.StackName),
+		Status:      string(s.StackStatus),
+		Created:     s.CreationTime,
+		LastUpdated: s.LastUpdatedTime,
+		StackID:     aws.ToString(s.StackId),
+	}
+}
+
+// stackFilter holds the list-cf-stacks filters.
+type stackFilter struct {
+	active bool
+	failed bool
+	status []string
+	name   string
+	tags   map[string]string
+}
+
+func (f *stackFilter) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.active, "active", false, "Only stacks that are not deleted")
+	cmd.Flags().BoolVar(&f.failed, "failed", false, "Only stacks whose last operation failed or rolled back")
+	cmd.Flags().StringSliceVar(&f.status, "status", nil, "Only stacks with these statuses, e.g. CREATE_COMPLETE,UPDATE_COMPLETE")
+	cmd.Flags().StringVar(&f.name, "name", "", "Only stacks whose name matches this glob, e.g. 'web-*'")
+	cmd.Flags().StringToStringVar(&f.tags, "tag", nil, "Only stacks with this tag, as key=value (repeatable)")
+}
+
+// statuses returns the statuses selected by the flags in API order, or nil
+// when every status is listed. Like the other filters, --active, --failed
+// and --status each narrow the selection.
+func (f *stackFilter) statuses() ([]cftypes.StackStatus, error) {
+	known := cftypes.StackStatus("").Values()
+	for _, s := range f.status {
+		if !slices.Contains(known, cftypes.StackStatus(strings.ToUpper(s))) {
+			return nil, clierr.New(clierr.KindInput, "Unknown stack status %q", s)
+		}
+	}
+	if len(f.status) == 0 && !f.active && !f.failed {
+		return nil, nil
+	}
+
+	var statuses []cftypes.StackStatus
+	for _, s := range known {
+		switch {
+		case len(f.status) > 0 && !slices.ContainsFunc(f.status, func(v string) bool { return strings.EqualFold(v, string(s)) }):
+		case f.active && s == cftypes.StackStatusDeleteComplete:
+		case f.failed && !failedStatus(string(s)):
+		default:
+			statuses = append(statuses, s)
+		}
+	}
+	if len(statuses) == 0 {
+		return nil, clierr.New(clierr.KindInput, "No stack status matches --active, --failed and --status together")
+	}
+	return statuses, nil
+}
+
+// validate checks the name glob before any request is made.
+func (f *stackFilter) validate() error {
+	if _, err := path.Match(f.name, ""); err != nil {
+		return clierr.New(clierr.KindInput, "Invalid --name pattern %q", f.name)
+	}
+	return nil
+}
+
+// match applies the filters that ListStacks can't apply itself.
+func (f *stackFilter) match(name string, status cftypes.StackStatus, statuses []cftypes.StackStatus, tags []cftypes.Tag) bool {
+	if f.name != "" {
+		if ok, _ := path.Match(f.name, name); !ok {
+			return false
+		}
+	}
+	if statuses != nil && !slices.Contains(statuses, status) {
+		return false
+	}
+	for k, v := range f.tags {
+		if !slices.ContainsFunc(tags, func(t cftypes.Tag) bool { return aws.ToString(t.Key) == k && aws.ToString(t.Value) == v }) {
+			return false
+		}
+	}
+	return true
+}
+
+func listStacksCmd(clients ClientFactory) *cobra.Command {
+	var pages pageFlags
+	var fan fanoutFlags
+	var filter stackFilter
+
+	cmd := &cobra.Command{
+		Use:   "list-cf-stacks",
+		Short: "List CloudFormation stacks",
+		Example: `  devctl aws list-cf-stacks --active --name 'web-*'
+  devctl aws list-cf-stacks --failed
+  devctl aws list-cf-stacks --tag team=platform --status UPDATE_COMPLETE`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			statuses, err := filter.statuses()
+			if err != nil {
+				return err
+			}
+			if err := filter.validate(); err != nil {
+				return err
+			}
+
+			return runList(cmd, clients, &pages, &fan, true, stackColumns,
+				func(ctx context.Context, t target, start pageStart, emit func(stackRecord) error, flush func() error) error {
+					client, err := t.clients.CloudFormation(ctx)
+					if err != nil {
+						return err
+					}
+					emitHere := func(r stackRecord) error {
+						r.origin = t.origin
+						return emit(r)
+					}
+
+					// ListStacks has no tags; DescribeStacks has them but
+					// leaves out deleted stacks
+					if len(filter.tags) > 0 {
+						paginator := cloudformation.NewDescribeStacksPaginator(client, &cloudformation.DescribeStacksInput{NextToken: start.token})
+						return paginate(ctx, cmd, &pages, start, paginator.HasMorePages,
+							func(ctx context.Context) ([]stackRecord, *string, error) {
+								page, err := paginator.NextPage(ctx)
+								if err != nil {
+									return nil, nil, awsError(err, "Failed to describe stacks")
+								}
+								var records []stackRecord
+								for _, s := range page.Stacks {
+									if filter.match(aws.ToString(s.StackName), s.StackStatus, statuses, s.Tags) {
+										records = append(records, newStackRecord(s))
+									}
+								}
+								return records, page.NextToken, nil
+							}, emitHere, flush)
+					}
+
+					paginator := cloudformation.NewListStacksPaginator(client, &cloudformation.ListStacksInput{
+						NextToken:         start.token,
+						StackStatusFilter: statuses,
+					})
+					return paginate(ctx, cmd, &pages, start, paginator.HasMorePages,
+						func(ctx context.Context) ([]stackRecord, *string, error) {
+							page, err := paginator.NextPage(ctx)
+							if err != nil {
+								return nil, nil, awsError(err, "Failed to list stacks")
+							}
+							var records []stackRecord
+							for _, summary := range page.StackSummaries {
+								if !filter.match(aws.ToString(summary.StackName), summary.StackStatus, nil, nil) {
+									continue
+								}
+								records = append(records, stackRecord{
+									Name:        aws.ToString(summary.StackName),
+									Status:      string(summary.StackStatus),
+									Created:     summary.CreationTime,
+									LastUpdated: summary.LastUpdatedTime,
+									StackID:     aws.ToString(summary.StackId),
+								})
+							}
+							return records, page.NextToken, nil
+						}, emitHere, flush)
+				})
+		},
+	}
+
+	// ListStacks has no page size parameter
+	pages.register(cmd, false)
+	fan.register(cmd)
+	filter.register(cmd)
+	return cmd
+}
+
+type stackOutput struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	ExportName  string `json:"exportName,omitempty"`
+}
+
+type nestedStack struct {
+	LogicalID string `json:"logicalId"`
+	StackID   string `json:"stackId,omitempty"`
+	Status    string `json:"status"`
+}
+
+type stackDetail struct {
+	stackRecord
+	Description           string            `json:"description,omitempty"`
+	StatusReason          string            `json:"statusReason,omitempty"`
+	TerminationProtection bool              `json:"terminationProtection"`
+	DriftStatus           string            `json:"driftStatus,omitempty"`
+	DriftCheckedAt        *time.Time        `json:"driftCheckedAt,omitempty"`
+	Parameters            map[string]string `json:"parameters,omitempty"`
+	Outputs               []stackOutput     `json:"outputs,omitempty"`
+	Tags                  map[string]string `json:"tags,omitempty"`
+	NestedStacks          []nestedStack     `json:"nestedStacks,omitempty"`
+}
+
+var stackDetailColumns = []printer.Column[stackDetail]{
+	{Header: "Name", Value: func(s stackDetail) string { return s.Name }},
+	{Header: "Status", Value: func(s stackDetail) string { return s.Status }},
+	{Header: "Drift", Value: func(s stackDetail) string { return printer.Or(s.DriftStatus) }},
+	{Header: "Last Updated", Value: func(s stackDetail) string { return printer.Time(s.LastUpdated) }},
+}
+
+func describeStackCmd(clients ClientFactory) *cobra.Command {
+	return &cobra.Command{
+		Use:   "describe-cf-stack [stack]",
+		Short: "Show the parameters, outputs, tags, drift status and nested stacks of a stack",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Stack name is required")
+			}
+			stackName := args[0]
+
+			client, err := clients.CloudFormation(cmd.Context())
+			if err != nil {
+				return err
+			}
+			stack, err := describeStack(cmd.Context(), client, stackName)
+			if err != nil {
+				return err
+			}
+
+			detail := stackDetail{
+				stackRecord:           newStackRecord(stack),
+				Description:           aws.ToString(stack.Description),
+				StatusReason:          aws.ToString(stack.StackStatusReason),
+				TerminationProtection: aws.ToBool(stack.EnableTerminationProtection),
+				Parameters:            map[string]string{},
+				Tags:                  map[string]string{},
+			}
+			if stack.DriftInformation != nil {
+				detail.DriftStatus = string(stack.DriftInformation.StackDriftStatus)
+				detail.DriftCheckedAt = stack.DriftInformation.LastCheckTimestamp
+			}
+			for _, p := range stack.Parameters {
+				detail.Parameters[aws.ToString(p.ParameterKey)] = aws.ToString(p.ParameterValue)
+			}
+			for _, o := range stack.Outputs {
+				detail.Outputs = append(detail.Outputs, stackOutput{
+					Key:         aws.ToString(o.OutputKey),
+					Value:       aws.ToString(o.OutputValue),
+					Description: aws.ToString(o.Description),
+					ExportName:  aws.ToString(o.ExportName),
+				})
+			}
+			for _, t := range stack.Tags {
+				detail.Tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+			}
+
+			paginator := cloudformation.NewListStackResourcesPaginator(client, &cloudformation.ListStackResourcesInput{
+				StackName: aws.String(stackName),
+			})
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(cmd.Context())
+				if err != nil {
+					return awsError(err, "Failed to list resources of stack %s", stackName)
+				}
+				for _, r := range page.StackResourceSummaries {
+					if aws.ToString(r.ResourceType) == "AWS::CloudFormation::Stack" {
+						detail.NestedStacks = append(detail.NestedStacks, nestedStack{
+							LogicalID: aws.ToString(r.LogicalResourceId),
+							StackID:   aws.ToString(r.PhysicalResourceId),
+							Status:    string(r.ResourceStatus),
+						})
+					}
+				}
+			}
+
+			if output := printer.Output(cmd); !printer.IsTable(output) {
+				return printer.PrintAll(cmd.OutOrStdout(), output, stackDetailColumns, []stackDetail{detail})
+			}
+			return printStackDetail(cmd.OutOrStdout(), detail)
+		},
+	}
+}
+
+// printStackDetail writes the human-readable form of describe-cf-stack.
+func printStackDetail(out io.Writer, d stackDetail) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", d.Name)
+	fmt.Fprintf(w, "Stack ID:\t%s\n", d.StackID)
+	fmt.Fprintf(w, "Status:\t%s\n", d.Status)
+	if d.StatusReason != "" {
+		fmt.Fprintf(w, "Status reason:\t%s\n", d.StatusReason)
+	}
+	if d.Description != "" {
+		fmt.Fprintf(w, "Description:\t%s\n", d.Description)
+	}
+	fmt.Fprintf(w, "Created:\t%s\n", printer.Time(d.Created))
+	fmt.Fprintf(w, "Last updated:\t%s\n", printer.Time(d.LastUpdated))
+	fmt.Fprintf(w, "Termination protection:\t%s\n", enabledString(d.TerminationProtection))
+	drift := printer.Or(d.DriftStatus)
+	if d.DriftCheckedAt != nil {
+		drift += " (checked " + printer.Time(d.DriftCheckedAt) + ")"
+	}
+	fmt.Fprintf(w, "Drift:\t%s\n", drift)
+
+	section := func(title string, n int) bool {
+		if n == 0 {
+			return false
+		}
+		fmt.Fprintf(w, "\n%s:\n", title)
+		return true
+	}
+	if section("Parameters", len(d.Parameters)) {
+		for _, k := range sortedKeys(d.Parameters) {
+			fmt.Fprintf(w, "  %s\t%s\n", k, d.Parameters[k])
+		}
+	}
+	if section("Outputs", len(d.Outputs)) {
+		for _, o := range d.Outputs {
+			line := fmt.Sprintf("  %s\t%s", o.Key, o.Value)
+			if o.ExportName != "" {
+				line += "\t(export: " + o.ExportName + ")"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	if section("Tags", len(d.Tags)) {
+		for _, k := range sortedKeys(d.Tags) {
+			fmt.Fprintf(w, "  %s\t%s\n", k, d.Tags[k])
+		}
+	}
+	if section("Nested stacks", len(d.NestedStacks)) {
+		for _, n := range d.NestedStacks {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", n.LogicalID, n.Status, n.StackID)
+		}
+	}
+	return w.Flush()
+}
+
+type stackResourceRecord struct {
+	LogicalID      string `json:"logicalId"`
+	Type           string `json:"type"`
+	PhysicalID     string `json:"physicalId,omitempty"`
+	Status         string `json:"status"`
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+}
+
+var stackResourceColumns = []printer.Column[stackResourceRecord]{
+	{Header: "Logical ID", Value: func(r stackResourceRecord) string { return r.LogicalID }},
+	{Header: "Type", Value: func(r stackResourceRecord) string { return r.Type }},
+	{Header: "Physical ID", Value: func(r stackResourceRecord) string { return printer.Or(r.PhysicalID) }},
+	{Header: "Deletion Policy", Value: func(r stackResourceRecord) string { return printer.Or(r.DeletionPolicy) }},
+}
+
+// retained reports whether CloudFormation leaves the resource in place when
+// the stack is deleted.
+func (r stackResourceRecord) retained() bool {
+	return strings.HasPrefix(r.DeletionPolicy, "Retain")
+}
+
+// listStackResources returns the resources of a stack with the deletion
+// policies set in its template.
+func listStackResources(ctx context.Context, client CloudFormationAPI, stack string) ([]stackResourceRecord, error) {
+	template, err := client.GetTemplate(ctx, &cloudformation.GetTemplateInput{StackName: aws.String(stack)})
+	if err != nil {
+		return nil, awsError(err, "Failed to get template of stack %s", stack)
+	}
+	policies := deletionPolicies(aws.ToString(template.TemplateBody))
+
+	var records []stackResourceRecord
+	paginator := cloudformation.NewListStackResourcesPaginator(client, &cloudformation.ListStackResourcesInput{
+		StackName: aws.String(stack),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, awsError(err, "Failed to list resources of stack %s", stack)
+		}
+		for _, r := range page.StackResourceSummaries {
+			logicalID := aws.ToString(r.LogicalResourceId)
+			records = append(records, stackResourceRecord{
+				LogicalID:      logicalID,
+				Type:           aws.ToString(r.ResourceType),
+				PhysicalID:     aws.ToString(r.PhysicalResourceId),
+				Status:         string(r.ResourceStatus),
+				DeletionPolicy: policies[logicalID],
+			})
+		}
+	}
+	return records, nil
+}
+
+// describeStack returns a single stack by name or ID.
+func describeStack(ctx context.Context, client CloudFormationAPI, stack string) (cftypes.Stack, error) {
+	out, err := client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: aws.String(stack)})
+	if err != nil {
+		return cftypes.Stack{}, awsError(err, "Failed to describe stack %s", stack)
+	}
+	if len(out.Stacks) == 0 {
+		return cftypes.Stack{}, clierr.New(clierr.KindNotFound, "Stack %s not found", stack)
+	}
+	return out.Stacks[0], nil
+}
+
+// Delete cloudformation stack
+func deleteStackCmd(clients ClientFactory) *cobra.Command {
+	var dryRun, yes, wait bool
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "delete-cf-stack [stack]",
+		Short: "Delete a CloudFormation stack",
+		Long: `Show the resources of a stack, then delete it after confirmation.
+
+The stack name has to be typed to confirm unless --yes is given. Resources
+with a Retain deletion policy are listed, since they outlive the stack, and
+stacks with termination protection are refused.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Stack name is required")
+			}
+			stackName := args[0]
+
+			client, err := clients.CloudFormation(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			stack, err := describeStack(cmd.Context(), client, stackName)
+			if err != nil {
+				return err
+			}
+			resources, err := listStackResources(cmd.Context(), client, stackName)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			protected := aws.ToBool(stack.EnableTerminationProtection)
+			fmt.Fprintf(out, "Stack:                  %s (%s)\n", stackName, stack.StackStatus)
+			fmt.Fprintf(out, "Stack ID:               %s\n", aws.ToString(stack.StackId))
+			fmt.Fprintf(out, "Termination protection: %s\n", enabledString(protected))
+			fmt.Fprintf(out, "Resources:              %d\n\n", len(resources))
+			if err := printer.PrintAll(out, printer.FormatTable, stackResourceColumns, resources); err != nil {
+				return err
+			}
+
+			var retained []string
+			for _, r := range resources {
+				if r.retained() {
+					retained = append(retained, r.LogicalID)
+				}
+			}
+			if len(retained) > 0 {
+				fmt.Fprintf(out, "\n⚠️ %d resources will be kept after deletion (DeletionPolicy Retain): %s\n",
+					len(retained), strings.Join(retained, ", "))
+			}
+
+			if protected {
+				return clierr.New(clierr.KindInput, "Stack %s has termination protection enabled; disable it before deleting", stackName)
+			}
+			if dryRun {
+				fmt.Fprintf(out, "\n🔍 Dry run: stack %s would be deleted.\n", stackName)
+				return nil
+			}
+			if !yes {
+				ok, err := prompt.ConfirmText(cmd.InOrStdin(), cmd.ErrOrStderr(),
+					fmt.Sprintf("Delete stack %s and its %d resources?", stackName, len(resources)), stackName)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return clierr.New(clierr.KindAborted, "Deletion of stack %s cancelled", stackName)
+				}
+			}
+
+			// deleted stacks can only be looked up by ID
+			stackID := aws.ToString(stack.StackId)
+			tail := newEventTail(client, stackID, out)
+			if wait {
+				if err := tail.skipExisting(cmd.Context()); err != nil {
+					return err
+				}
+			}
+
+			_, err = client.DeleteStack(cmd.Context(), &cloudformation.DeleteStackInput{
+				StackName: aws.String(stackID),
+			})
+			if err != nil {
+				return awsError(err, "Failed to delete stack %s", stackName)
+			}
+			if !wait {
+				fmt.Fprintf(out, "✅ Stack %s deletion initiated.\n", stackName)
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			status, events, err := waitForStack(ctx, client, tail, stackID)
+			if err != nil {
+				return err
+			}
+			if status == cftypes.StackStatusDeleteComplete {
+				fmt.Fprintf(out, "✅ Stack %s deleted.\n", stackName)
+				return nil
+			}
+
+			printFailedResources(out, "Resources that failed to delete:", events, stackName)
+			return clierr.New(clierr.KindRemote, "Stack %s was not deleted (%s)", stackName, status)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be deleted without deleting")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Delete without asking for confirmation")
+	cmd.Flags().BoolVar(&wait, "wait", false, "Stream stack events until the deletion finishes")
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Minute, "How long --wait waits for the deletion")
+	return cmd
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,131 @@
+package awshelper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// cachedCredentialsMargin is how long before expiry cached credentials are
+// refreshed, so a command never starts with credentials about to lapse.
+const cachedCredentialsMargin = 5 * time.Minute
+
+// assumeRole returns credentials for opts.roleARN obtained with the
+// credentials in cfg. They are cached on disk until they expire, so an MFA
+// code is only asked for once per session.
+func assumeRole(cfg aws.Config, opts *clientOptions) aws.CredentialsProvider {
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), opts.roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = fmt.Sprintf("devctl-%d", time.Now().Unix())
+		if opts.externalID != "" {
+			o.ExternalID = aws.String(opts.externalID)
+		}
+		if opts.mfaSerial != "" {
+			o.SerialNumber = aws.String(opts.mfaSerial)
+			o.TokenProvider = func() (string, error) { return promptMFAToken(opts.mfaSerial) }
+		}
+	})
+	return aws.NewCredentialsCache(&fileCache{path: credentialsCachePath(opts), provider: provider})
+}
+
+// promptMu keeps concurrent role sessions from prompting at the same time.
+var promptMu sync.Mutex
+
+// promptMFAToken reads an MFA code from the terminal. The prompt goes to
+// stderr so it doesn't end up in piped output.
+func promptMFAToken(serial string) (string, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	fmt.Fprintf(os.Stderr, "🔐 MFA code for %s: ", serial)
+	var code string
+	if _, err := fmt.Fscanln(os.Stdin, &code); err != nil {
+		return "", fmt.Errorf("reading MFA code: %w", err)
+	}
+	return strings.TrimSpace(code), nil
+}
+
+// credentialsCachePath returns the cache file for the role session described
+// by opts, or "" when there is no cache directory.
+func credentialsCachePath(opts *clientOptions) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	key := strings.Join([]string{opts.profile, opts.roleARN, opts.externalID, opts.mfaSerial, opts.endpointURL}, "\x00")
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, "devctl", "aws", hex.EncodeToString(sum[:16])+".json")
+}
+
+// fileCache keeps the credentials of provider in a file until they expire.
+type fileCache struct {
+	path     string
+	provider aws.CredentialsProvider
+}
+
+// cacheLocks holds a mutex per cache file. Clients for other regions build
+// their own fileCache for the same file, and fan-out retrieves them all at
+// once; the lock makes one assume the role while the rest wait to load it.
+var cacheLocks sync.Map
+
+func (c *fileCache) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	if creds, ok := c.load(); ok {
+		return creds, nil
+	}
+	mu, _ := cacheLocks.LoadOrStore(c.path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	if creds, ok := c.load(); ok {
+		return creds, nil
+	}
+
+	creds, err := c.provider.Retrieve(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	// a failed write only costs another AssumeRole call next time
+	_ = c.store(creds)
+	return creds, nil
+}
+
+func (c *fileCache) load() (aws.Credentials, bool) {
+	if c.path == "" {
+		return aws.Credentials{}, false
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return aws.Credentials{}, false
+	}
+	var creds aws.Credentials
+	if err := json.Unmarshal(data, &creds); err != nil || !creds.HasKeys() {
+		return aws.Credentials{}, false
+	}
+	if creds.CanExpire && time.Until(creds.Expires) < cachedCredentialsMargin {
+		return aws.Credentials{}, false
+	}
+	return creds, true
+}
+
+func (c *fileCache) store(creds aws.Credentials) error {
+	if c.path == "" || !creds.CanExpire {
+		return nil
+	}
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o600)
+}
@@ -0,0 +1,422 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"devctl/pkg/progress"
+	"devctl/pkg/prompt"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// maxTemplateBody is the largest template CloudFormation accepts inline.
+const maxTemplateBody = 51200
+
+type changeRecord struct {
+	Action      string   `json:"action"`
+	LogicalID   string   `json:"logicalId"`
+	Type        string   `json:"type"`
+	PhysicalID  string   `json:"physicalId,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+	Changed     []string `json:"changed,omitempty"`
+}
+
+var changeSymbols = map[string]string{
+	string(cftypes.ChangeActionAdd):    "+",
+	string(cftypes.ChangeActionModify): "~",
+	string(cftypes.ChangeActionRemove): "-",
+	string(cftypes.ChangeActionImport): "<",
+}
+
+var changeColumns = []printer.Column[changeRecord]{
+	{Header: "Action", Value: func(c changeRecord) string { return printer.Or(changeSymbols[c.Action]) + " " + c.Action }},
+	{Header: "Logical ID", Value: func(c changeRecord) string { return c.LogicalID }},
+	{Header: "Type", Value: func(c changeRecord) string { return c.Type }},
+	{Header: "Replacement", Value: func(c changeRecord) string { return replacementString(c.Replacement) }},
+	{Header: "Changed", Value: func(c changeRecord) string { return printer.Or(strings.Join(c.Changed, ", ")) }},
+	{Header: "Physical ID", Wide: true, Value: func(c changeRecord) string { return printer.Or(c.PhysicalID) }},
+}
+
+func replacementString(r string) string {
+	switch r {
+	case string(cftypes.ReplacementTrue):
+		return "⚠️ yes"
+	case string(cftypes.ReplacementConditional):
+		return "⚠️ maybe"
+	case string(cftypes.ReplacementFalse):
+		return "no"
+	}
+	return "-"
+}
+
+func newChangeRecord(rc *cftypes.ResourceChange) changeRecord {
+	c := changeRecord{
+		Action:      string(rc.Action),
+		LogicalID:   aws.ToString(rc.LogicalResourceId),
+		Type:        aws.ToString(rc.ResourceType),
+		PhysicalID:  aws.ToString(rc.PhysicalResourceId),
+		Replacement: string(rc.Replacement),
+	}
+	// name the changed properties where CloudFormation reports them,
+	// otherwise the changed attributes such as Tags
+	seen := map[string]bool{}
+	for _, d := range rc.Details {
+		if d.Target == nil {
+			continue
+		}
+		name := string(d.Target.Attribute)
+		if d.Target.Attribute == cftypes.ResourceAttributeProperties && d.Target.Name != nil {
+			name = aws.ToString(d.Target.Name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			c.Changed = append(c.Changed, name)
+		}
+	}
+	if len(c.Changed) == 0 {
+		for _, scope := range rc.Scope {
+			c.Changed = append(c.Changed, string(scope))
+		}
+	}
+	return c
+}
+
+func deployStackCmd(clients ClientFactory) *cobra.Command {
+	var templatePath, parametersPath string
+	var capabilities []string
+	var tags map[string]string
+	var yes, noExecute bool
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "deploy-cf-stack [stack]",
+		Short: "Create or update a CloudFormation stack through a change set",
+		Long: `Create a change set from a local template, preview the resources it adds,
+modifies and removes, and execute it after approval. Stack events are streamed
+until the stack reaches a final state.
+
+The parameters file is either the AWS CLI format, a list of
+{"ParameterKey": ..., "ParameterValue": ...} objects, or a plain mapping of
+names to values, in JSON or YAML. On updates, parameters missing from the file
+keep their current value.`,
+		Example: `  devctl aws deploy-cf-stack web --template web.yaml --parameters prod.json
+  devctl aws deploy-cf-stack web --template web.yaml --capabilities CAPABILITY_NAMED_IAM --yes`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Stack name is required")
+			}
+			stackName := args[0]
+
+			body, err := os.ReadFile(templatePath)
+			if err != nil {
+				return clierr.Wrap(clierr.KindInput, err, "Failed to read template")
+			}
+			if len(body) > maxTemplateBody {
+				return clierr.New(clierr.KindInput, "Template %s is %d bytes; CloudFormation accepts at most %d bytes inline",
+					templatePath, len(body), maxTemplateBody)
+			}
+			values := map[string]string{}
+			if parametersPath != "" {
+				if values, err = readParameters(parametersPath); err != nil {
+					return err
+				}
+			}
+
+			client, err := clients.CloudFormation(cmd.Context())
+			if err != nil {
+				return err
+			}
+			// --timeout bounds creating the change set and, once approved,
+			// the deployment; time spent reviewing the changes is not counted
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+
+			// a stack left in REVIEW_IN_PROGRESS by an unexecuted change set
+			// is created, not updated
+			changeSetType := cftypes.ChangeSetTypeUpdate
+			var current []cftypes.Parameter
+			stack, err := describeStack(ctx, client, stackName)
+			switch {
+			case clierr.KindOf(err) == clierr.KindNotFound:
+				changeSetType = cftypes.ChangeSetTypeCreate
+			case err != nil:
+				return err
+			case stack.StackStatus == cftypes.StackStatusReviewInProgress:
+				changeSetType = cftypes.ChangeSetTypeCreate
+			case stack.StackStatus == cftypes.StackStatusRollbackComplete:
+				return clierr.New(clierr.KindInput, "Stack %s is in ROLLBACK_COMPLETE after a failed create and cannot be updated; "+
+					"delete it with `devctl aws delete-cf-stack %s` and deploy again", stackName, stackName)
+			default:
+				current = stack.Parameters
+			}
+
+			input := &cloudformation.CreateChangeSetInput{
+				StackName:     aws.String(stackName),
+				ChangeSetName: aws.String(fmt.Sprintf("devctl-%s", time.Now().UTC().Format("20060102-150405"))),
+				ChangeSetType: changeSetType,
+				TemplateBody:  aws.String(string(body)),
+				Parameters:    changeSetParameters(values, current, templateParameters(string(body))),
+			}
+			for _, c := range capabilities {
+				input.Capabilities = append(input.Capabilities, cftypes.Capability(c))
+			}
+			for _, k := range sortedKeys(tags) {
+				input.Tags = append(input.Tags, cftypes.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+			}
+
+			created, err := client.CreateChangeSet(ctx, input)
+			if err != nil {
+				return awsError(err, "Failed to create change set for %s", stackName)
+			}
+			changeSetID := aws.ToString(created.Id)
+
+			changes, err := waitForChangeSet(ctx, cmd.ErrOrStderr(), client, stackName, changeSetID)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if changes == nil {
+				fmt.Fprintf(out, "✅ Stack %s is up to date; nothing to deploy.\n", stackName)
+				if _, err := client.DeleteChangeSet(ctx, &cloudformation.DeleteChangeSetInput{ChangeSetName: aws.String(changeSetID)}); err != nil {
+					return awsError(err, "Failed to delete empty change set")
+				}
+				return nil
+			}
+
+			if err := printer.PrintAll(out, printer.Output(cmd), changeColumns, changes); err != nil {
+				return err
+			}
+			summary := summarizeChanges(changes)
+			fmt.Fprintf(cmd.ErrOrStderr(), "\n%s\n", summary)
+
+			if noExecute {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Change set %s was not executed.\n", changeSetID)
+				return nil
+			}
+			if !yes {
+				ok, err := prompt.Confirm(cmd.InOrStdin(), cmd.ErrOrStderr(), fmt.Sprintf("Deploy these changes to %s?", stackName))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					if _, err := client.DeleteChangeSet(cmd.Context(), &cloudformation.DeleteChangeSetInput{ChangeSetName: aws.String(changeSetID)}); err != nil {
+						return awsError(err, "Failed to delete change set")
+					}
+					return clierr.New(clierr.KindAborted, "Deployment of %s cancelled", stackName)
+				}
+				ctx, cancel = context.WithTimeout(cmd.Context(), timeout)
+				defer cancel()
+			}
+
+			tail := newEventTail(client, stackName, out)
+			if err := tail.skipExisting(ctx); err != nil {
+				return err
+			}
+			if _, err := client.ExecuteChangeSet(ctx, &cloudformation.ExecuteChangeSetInput{
+				ChangeSetName: aws.String(changeSetID),
+			}); err != nil {
+				return awsError(err, "Failed to execute change set for %s", stackName)
+			}
+
+			status, events, err := waitForStack(ctx, client, tail, stackName)
+			if err != nil {
+				return err
+			}
+			if status == cftypes.StackStatusCreateComplete || status == cftypes.StackStatusUpdateComplete {
+				fmt.Fprintf(out, "✅ Stack %s deployed (%s).\n", stackName, status)
+				return nil
+			}
+			printFailedResources(out, "Failed resources:", events, stackName)
+			return clierr.New(clierr.KindRemote, "Deployment of %s failed (%s)", stackName, status)
+		},
+	}
+
+	cmd.Flags().StringVarP(&templatePath, "template", "t", "", "Path to the template file (required)")
+	cmd.Flags().StringVarP(&parametersPath, "parameters", "p", "", "Path to a JSON or YAML parameters file")
+	cmd.Flags().StringSliceVar(&capabilities, "capabilities", nil, "Capabilities to acknowledge, e.g. CAPABILITY_IAM,CAPABILITY_NAMED_IAM")
+	cmd.Flags().StringToStringVar(&tags, "tags", nil, "Stack tags as key=value pairs")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Execute the change set without asking for approval")
+	cmd.Flags().BoolVar(&noExecute, "no-execute", false, "Only create and preview the change set")
+	cmd.Flags().DurationVar(&timeout, "timeout", 60*time.Minute, "How long to wait for the change set and, after approval, for the deployment")
+	cmd.MarkFlagRequired("template")
+	return cmd
+}
+
+// readParameters reads a parameters file into a name to value map.
+func readParameters(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, clierr.Wrap(clierr.KindInput, err, "Failed to read parameters")
+	}
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, clierr.Wrap(clierr.KindInput, err, "Failed to parse parameters file %s", path)
+	}
+
+	values := map[string]string{}
+	var list []struct {
+		ParameterKey   string
+		ParameterValue interface{}
+	}
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, p := range list {
+			if p.ParameterKey == "" {
+				return nil, clierr.New(clierr.KindInput, "Parameters file %s has an entry without ParameterKey", path)
+			}
+			values[p.ParameterKey] = parameterString(p.ParameterValue)
+		}
+		return values, nil
+	}
+	var mapping map[string]interface{}
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, clierr.New(clierr.KindInput, "Parameters file %s must be a list of ParameterKey/ParameterValue objects or a mapping", path)
+	}
+	for k, v := range mapping {
+		values[k] = parameterString(v)
+	}
+	return values, nil
+}
+
+// parameterString formats a parameter value; lists become the comma
+// separated form CloudFormation expects for list parameters.
+func parameterString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = parameterString(item)
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// templateParameters returns the names of the parameters a template declares.
+func templateParameters(body string) map[string]bool {
+	params := map[string]bool{}
+	if section := templateSection(body, "Parameters"); section != nil {
+		for i := 0; i < len(section.Content); i += 2 {
+			params[section.Content[i].Value] = true
+		}
+	}
+	return params
+}
+
+// changeSetParameters combines the given values with the current stack
+// parameters: declared parameters without a new value keep their old one.
+func changeSetParameters(values map[string]string, current []cftypes.Parameter, declared map[string]bool) []cftypes.Parameter {
+	var params []cftypes.Parameter
+	for _, k := range sortedKeys(values) {
+		params = append(params, cftypes.Parameter{ParameterKey: aws.String(k), ParameterValue: aws.String(values[k])})
+	}
+	for _, p := range current {
+		key := aws.ToString(p.ParameterKey)
+		if _, ok := values[key]; !ok && declared[key] {
+			params = append(params, cftypes.Parameter{ParameterKey: aws.String(key), UsePreviousValue: aws.Bool(true)})
+		}
+	}
+	return params
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// waitForChangeSet waits until a change set is created and returns its
+// changes. A change set without changes fails; that returns nil changes and
+// no error.
+func waitForChangeSet(ctx context.Context, w io.Writer, client CloudFormationAPI, stackName, changeSetID string) ([]changeRecord, error) {
+	bar := progress.New(w, "Creating change set for "+stackName)
+	for {
+		out, err := client.DescribeChangeSet(ctx, &cloudformation.DescribeChangeSetInput{ChangeSetName: aws.String(changeSetID)})
+		if err != nil {
+			return nil, awsError(err, "Failed to describe change set for %s", stackName)
+		}
+
+		switch out.Status {
+		case cftypes.ChangeSetStatusCreateComplete:
+			bar.Done("done")
+			return collectChanges(ctx, client, out)
+		case cftypes.ChangeSetStatusFailed:
+			reason := aws.ToString(out.StatusReason)
+			if strings.Contains(reason, "didn't contain changes") || strings.Contains(reason, "No updates are to be performed") {
+				bar.Done("no changes")
+				return nil, nil
+			}
+			bar.Done("failed")
+			return nil, clierr.New(clierr.KindRemote, "Change set for %s failed: %s", stackName, reason)
+		default:
+			bar.Update(strings.ToLower(strings.ReplaceAll(string(out.Status), "_", " ")))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, clierr.Wrap(clierr.KindTimeout, ctx.Err(), "Gave up waiting for the change set of %s", stackName)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// collectChanges returns the changes of every page of a change set.
+func collectChanges(ctx context.Context, client CloudFormationAPI, out *cloudformation.DescribeChangeSetOutput) ([]changeRecord, error) {
+	changes := []changeRecord{}
+	for {
+		for _, c := range out.Changes {
+			if c.ResourceChange != nil {
+				changes = append(changes, newChangeRecord(c.ResourceChange))
+			}
+		}
+		if out.NextToken == nil {
+			return changes, nil
+		}
+		var err error
+		out, err = client.DescribeChangeSet(ctx, &cloudformation.DescribeChangeSetInput{
+			ChangeSetName: out.ChangeSetId,
+			NextToken:     out.NextToken,
+		})
+		if err != nil {
+			return nil, awsError(err, "Failed to describe change set")
+		}
+	}
+}
+
+// summarizeChanges counts the changes by action and calls out replacements.
+func summarizeChanges(changes []changeRecord) string {
+	counts := map[string]int{}
+	var replaced []string
+	for _, c := range changes {
+		counts[c.Action]++
+		if c.Replacement == string(cftypes.ReplacementTrue) || c.Replacement == string(cftypes.ReplacementConditional) {
+			replaced = append(replaced, c.LogicalID)
+		}
+	}
+	summary := fmt.Sprintf("%d to add, %d to modify, %d to remove", counts[string(cftypes.ChangeActionAdd)],
+		counts[string(cftypes.ChangeActionModify)], counts[string(cftypes.ChangeActionRemove)])
+	if len(replaced) > 0 {
+		summary += fmt.Sprintf("\n⚠️ %d resources may be replaced, losing their data and physical IDs: %s",
+			len(replaced), strings.Join(replaced, ", "))
+	}
+	return summary
+}
@@ -0,0 +1,205 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"devctl/pkg/progress"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/spf13/cobra"
+)
+
+// pollInterval is how often long-running CloudFormation operations are polled.
+var pollInterval = 5 * time.Second
+
+type propertyDifference struct {
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+type driftRecord struct {
+	LogicalID   string               `json:"logicalId"`
+	PhysicalID  string               `json:"physicalId,omitempty"`
+	Type        string               `json:"type"`
+	Status      string               `json:"status"`
+	Differences []propertyDifference `json:"differences,omitempty"`
+}
+
+func (r driftRecord) drifted() bool {
+	return r.Status == string(cftypes.StackResourceDriftStatusModified) ||
+		r.Status == string(cftypes.StackResourceDriftStatusDeleted)
+}
+
+var driftColumns = []printer.Column[driftRecord]{
+	{Header: "Logical ID", Value: func(r driftRecord) string { return r.LogicalID }},
+	{Header: "Type", Value: func(r driftRecord) string { return r.Type }},
+	{Header: "Status", Value: func(r driftRecord) string { return r.Status }},
+	{Header: "Differences", Value: func(r driftRecord) string { return strconv.Itoa(len(r.Differences)) }},
+	{Header: "Physical ID", Wide: true, Value: func(r driftRecord) string { return printer.Or(r.PhysicalID) }},
+}
+
+func newDriftRecord(d cftypes.StackResourceDrift) driftRecord {
+	r := driftRecord{
+		LogicalID:  aws.ToString(d.LogicalResourceId),
+		PhysicalID: aws.ToString(d.PhysicalResourceId),
+		Type:       aws.ToString(d.ResourceType),
+		Status:     string(d.StackResourceDriftStatus),
+	}
+	for _, diff := range d.PropertyDifferences {
+		r.Differences = append(r.Differences, propertyDifference{
+			Path:     aws.ToString(diff.PropertyPath),
+			Type:     string(diff.DifferenceType),
+			Expected: aws.ToString(diff.ExpectedValue),
+			Actual:   aws.ToString(diff.ActualValue),
+		})
+	}
+	return r
+}
+
+// check the cloudformation stack is drifted or not
+func checkStackDriftCmd(clients ClientFactory) *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "check-stack-drift [stack]",
+		Short: "Detect drift of a CloudFormation stack and report the differences",
+		Long: `Run drift detection on a stack, wait for it to finish and show every resource
+with its drift status. Modified resources are followed by the expected and
+actual value of each changed property.
+
+Exits with code 7 when the stack has drifted, so it can gate a pipeline.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Stack name is required")
+			}
+			stackName := args[0]
+
+			p, err := printer.New(cmd.OutOrStdout(), printer.Output(cmd), driftColumns)
+			if err != nil {
+				return err
+			}
+			client, err := clients.CloudFormation(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+
+			detection, err := client.DetectStackDrift(ctx, &cloudformation.DetectStackDriftInput{
+				StackName: aws.String(stackName),
+			})
+			if err != nil {
+				return awsError(err, "Failed to start drift detection for %s", stackName)
+			}
+			status, err := waitForDriftDetection(ctx, cmd.ErrOrStderr(), client, stackName, aws.ToString(detection.StackDriftDetectionId))
+			if err != nil {
+				return err
+			}
+
+			var records []driftRecord
+			paginator := cloudformation.NewDescribeStackResourceDriftsPaginator(client, &cloudformation.DescribeStackResourceDriftsInput{
+				StackName: aws.String(stackName),
+			})
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(ctx)
+				if err != nil {
+					return awsError(err, "Failed to get resource drift for %s", stackName)
+				}
+				for _, d := range page.StackResourceDrifts {
+					records = append(records, newDriftRecord(d))
+				}
+			}
+			sort.Slice(records, func(i, j int) bool { return records[i].LogicalID < records[j].LogicalID })
+
+			for _, r := range records {
+				if err := p.Print(r); err != nil {
+					return err
+				}
+			}
+			if err := p.Flush(); err != nil {
+				return err
+			}
+			if printer.IsTable(printer.Output(cmd)) {
+				printDriftDiff(cmd.OutOrStdout(), records)
+			}
+
+			if status.StackDriftStatus == cftypes.StackDriftStatusDrifted {
+				return clierr.New(clierr.KindCheckFailed, "Stack %s has drifted: %d resources differ from the template",
+					stackName, aws.ToInt32(status.DriftedStackResourceCount))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Minute, "How long to wait for drift detection")
+	return cmd
+}
+
+// waitForDriftDetection polls a drift detection until it is no longer in
+// progress. A failed detection, e.g. because some resources don't support
+// drift detection, still has results for the other resources, so it is only
+// reported as a warning.
+func waitForDriftDetection(ctx context.Context, w io.Writer, client CloudFormationAPI, stackName, detectionID string) (*cloudformation.DescribeStackDriftDetectionStatusOutput, error) {
+	bar := progress.New(w, "Detecting drift for "+stackName)
+	for {
+		status, err := client.DescribeStackDriftDetectionStatus(ctx, &cloudformation.DescribeStackDriftDetectionStatusInput{
+			StackDriftDetectionId: aws.String(detectionID),
+		})
+		if err != nil {
+			return nil, awsError(err, "Failed to get drift detection status for %s", stackName)
+		}
+
+		switch status.DetectionStatus {
+		case cftypes.StackDriftDetectionStatusDetectionInProgress:
+			bar.Update("in progress")
+		case cftypes.StackDriftDetectionStatusDetectionFailed:
+			bar.Done(fmt.Sprintf("⚠️ incomplete: %s", aws.ToString(status.DetectionStatusReason)))
+			return status, nil
+		default:
+			bar.Done(strings.ToLower(strings.ReplaceAll(string(status.StackDriftStatus), "_", " ")))
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, clierr.Wrap(clierr.KindTimeout, ctx.Err(), "Gave up waiting for drift detection of %s", stackName)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// printDriftDiff writes the property differences of the drifted resources
+// in a diff-like layout.
+func printDriftDiff(w io.Writer, records []driftRecord) {
+	for _, r := range records {
+		if !r.drifted() {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s (%s): %s\n", r.LogicalID, r.Type, r.Status)
+		if r.Status == string(cftypes.StackResourceDriftStatusDeleted) {
+			fmt.Fprintln(w, "  resource no longer exists")
+			continue
+		}
+		for _, d := range r.Differences {
+			fmt.Fprintf(w, "  %s\n", d.Path)
+			if d.Type != string(cftypes.DifferenceTypeAdd) {
+				fmt.Fprintf(w, "    - %s\n", d.Expected)
+			}
+			if d.Type != string(cftypes.DifferenceTypeRemove) {
+				fmt.Fprintf(w, "    + %s\n", d.Actual)
+			}
+		}
+	}
+}
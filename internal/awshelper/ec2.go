@@ -0,0 +1,179 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+)
+
+type instanceRecord struct {
+	origin
+	InstanceID       string     `json:"instanceId"`
+	Name             string     `json:"name,omitempty"`
+	State            string     `json:"state"`
+	Type             string     `json:"type"`
+	AvailabilityZone string     `json:"availabilityZone,omitempty"`
+	PrivateIP        string     `json:"privateIp,omitempty"`
+	PublicIP         string     `json:"publicIp,omitempty"`
+	ImageID          string     `json:"imageId,omitempty"`
+	LaunchTime       *time.Time `json:"launchTime,omitempty"`
+}
+
+var instanceColumns = []printer.Column[instanceRecord]{
+	{Header: "Instance ID", Value: func(i instanceRecord) string { return i.InstanceID }},
+	{Header: "Name", Value: func(i instanceRecord) string { return printer.Or(i.Name) }},
+	{Header: "State", Value: func(i instanceRecord) string { return i.State }},
+	{Header: "Type", Value: func(i instanceRecord) string { return i.Type }},
+	{Header: "Private IP", Value: func(i instanceRecord) string { return printer.Or(i.PrivateIP) }},
+	{Header: "Public IP", Value: func(i instanceRecord) string { return printer.Or(i.PublicIP) }},
+	{Header: "AZ", Value: func(i instanceRecord) string { return printer.Or(i.AvailabilityZone) }},
+	{Header: "AMI", Wide: true, Value: func(i instanceRecord) string { return printer.Or(i.ImageID) }},
+	{Header: "Launched", Wide: true, Value: func(i instanceRecord) string { return printer.Time(i.LaunchTime) }},
+}
+
+func newInstanceRecord(inst ec2types.Instance) instanceRecord {
+	r := instanceRecord{
+		InstanceID: aws.ToString(inst.InstanceId),
+		Name:       instanceName(inst),
+		Type:       string(inst.InstanceType),
+		PrivateIP:  aws.ToString(inst.PrivateIpAddress),
+		PublicIP:   aws.ToString(inst.PublicIpAddress),
+		ImageID:    aws.ToString(inst.ImageId),
+		LaunchTime: inst.LaunchTime,
+	}
+	if inst.State != nil {
+		r.State = string(inst.State.Name)
+	}
+	if inst.Placement != nil {
+		r.AvailabilityZone = aws.ToString(inst.Placement.AvailabilityZone)
+	}
+	return r
+}
+
+// instanceName returns the Name tag of inst.
+func instanceName(inst ec2types.Instance) string {
+	for _, t := range inst.Tags {
+		if aws.ToString(t.Key) == "Name" {
+			return aws.ToString(t.Value)
+		}
+	}
+	return ""
+}
+
+// instanceFilter holds the flags that select instances. They map onto
+// DescribeInstances filters, so the filtering happens server-side.
+type instanceFilter struct {
+	tags   map[string]string
+	states []string
+	name   string
+	vpc    string
+	subnet string
+}
+
+func (f *instanceFilter) register(cmd *cobra.Command) {
+	cmd.Flags().StringToStringVar(&f.tags, "tag", nil, "Only instances with this tag, as key=value (repeatable, value may be a glob)")
+	cmd.Flags().StringSliceVar(&f.states, "state", nil, "Only instances in these states, e.g. running,stopped")
+	cmd.Flags().StringVar(&f.name, "name", "", "Only instances whose Name tag matches this glob, e.g. 'web-*'")
+	cmd.Flags().StringVar(&f.vpc, "vpc", "", "Only instances in this VPC")
+	cmd.Flags().StringVar(&f.subnet, "subnet", "", "Only instances in this subnet")
+}
+
+func (f *instanceFilter) empty() bool {
+	return len(f.tags) == 0 && len(f.states) == 0 && f.name == "" && f.vpc == "" && f.subnet == ""
+}
+
+// filters returns the DescribeInstances filters for the flags.
+func (f *instanceFilter) filters() ([]ec2types.Filter, error) {
+	var filters []ec2types.Filter
+	add := func(name string, values ...string) {
+		filters = append(filters, ec2types.Filter{Name: aws.String(name), Values: values})
+	}
+
+	if len(f.states) > 0 {
+		known := ec2types.InstanceStateName("").Values()
+		var states []string
+		for _, s := range f.states {
+			state := ec2types.InstanceStateName(strings.ToLower(s))
+			if !slices.Contains(known, state) {
+				return nil, clierr.New(clierr.KindInput, "Unknown instance state %q", s)
+			}
+			states = append(states, string(state))
+		}
+		add("instance-state-name", states...)
+	}
+	// EC2 filter values accept * and ? wildcards
+	if f.name != "" {
+		add("tag:Name", f.name)
+	}
+	for _, k := range sortedKeys(f.tags) {
+		add("tag:"+k, f.tags[k])
+	}
+	if f.vpc != "" {
+		add("vpc-id", f.vpc)
+	}
+	if f.subnet != "" {
+		add("subnet-id", f.subnet)
+	}
+	return filters, nil
+}
+
+func listEC2Cmd(clients ClientFactory) *cobra.Command {
+	var pages pageFlags
+	var fan fanoutFlags
+	var filter instanceFilter
+
+	cmd := &cobra.Command{
+		Use:   "list-ec2",
+		Short: "List EC2 instances",
+		Example: `  devctl aws list-ec2 --state running --name 'web-*'
+  devctl aws list-ec2 --tag team=platform --tag env=prod -o wide
+  devctl aws list-ec2 --vpc vpc-0abc --all-regions`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filters, err := filter.filters()
+			if err != nil {
+				return err
+			}
+
+			return runList(cmd, clients, &pages, &fan, true, instanceColumns,
+				func(ctx context.Context, t target, start pageStart, emit func(instanceRecord) error, flush func() error) error {
+					client, err := t.clients.EC2(ctx)
+					if err != nil {
+						return err
+					}
+
+					paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{NextToken: start.token, Filters: filters},
+						func(o *ec2.DescribeInstancesPaginatorOptions) { o.Limit = pages.limit(5, 1000) })
+					return paginate(ctx, cmd, &pages, start, paginator.HasMorePages,
+						func(ctx context.Context) ([]ec2types.Instance, *string, error) {
+							page, err := paginator.NextPage(ctx)
+							if err != nil {
+								return nil, nil, awsError(err, "Failed to describe instances")
+							}
+							var instances []ec2types.Instance
+							for _, res := range page.Reservations {
+								instances = append(instances, res.Instances...)
+							}
+							return instances, page.NextToken, nil
+						},
+						func(inst ec2types.Instance) error {
+							r := newInstanceRecord(inst)
+							r.origin = t.origin
+							return emit(r)
+						}, flush)
+				})
+		},
+	}
+
+	pages.register(cmd, true)
+	fan.register(cmd)
+	filter.register(cmd)
+	return cmd
+}
@@ -0,0 +1,347 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+)
+
+type networkInterface struct {
+	ID         string   `json:"id"`
+	SubnetID   string   `json:"subnetId,omitempty"`
+	PrivateIPs []string `json:"privateIps,omitempty"`
+	PublicIP   string   `json:"publicIp,omitempty"`
+}
+
+type ingressRule struct {
+	Protocol string `json:"protocol"`
+	Ports    string `json:"ports"`
+	Source   string `json:"source"`
+}
+
+type securityGroup struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Inbound []ingressRule `json:"inbound,omitempty"`
+}
+
+type volume struct {
+	ID        string `json:"id"`
+	Device    string `json:"device,omitempty"`
+	SizeGiB   int32  `json:"sizeGiB"`
+	Type      string `json:"type"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+type instanceDetail struct {
+	instanceRecord
+	VpcID             string             `json:"vpcId,omitempty"`
+	SubnetID          string             `json:"subnetId,omitempty"`
+	InstanceProfile   string             `json:"instanceProfile,omitempty"`
+	SystemStatus      string             `json:"systemStatus,omitempty"`
+	InstanceStatus    string             `json:"instanceStatus,omitempty"`
+	NetworkInterfaces []networkInterface `json:"networkInterfaces,omitempty"`
+	SecurityGroups    []securityGroup    `json:"securityGroups,omitempty"`
+	Volumes           []volume           `json:"volumes,omitempty"`
+	Tags              map[string]string  `json:"tags,omitempty"`
+	ConsoleOutput     string             `json:"consoleOutput,omitempty"`
+}
+
+var instanceDetailColumns = []printer.Column[instanceDetail]{
+	{Header: "Instance ID", Value: func(i instanceDetail) string { return i.InstanceID }},
+	{Header: "Name", Value: func(i instanceDetail) string { return printer.Or(i.Name) }},
+	{Header: "State", Value: func(i instanceDetail) string { return i.State }},
+	{Header: "System Status", Value: func(i instanceDetail) string { return printer.Or(i.SystemStatus) }},
+	{Header: "Instance Status", Value: func(i instanceDetail) string { return printer.Or(i.InstanceStatus) }},
+}
+
+// describeInstance returns the instance with the given ID.
+func describeInstance(ctx context.Context, client EC2API, instanceID string) (ec2types.Instance, error) {
+	out, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		return ec2types.Instance{}, awsError(err, "Failed to describe instance %s", instanceID)
+	}
+	if len(out.Reservations) == 0 || len(out.Reservations[0].Instances) == 0 {
+		return ec2types.Instance{}, clierr.New(clierr.KindNotFound, "Instance %s not found", instanceID)
+	}
+	return out.Reservations[0].Instances[0], nil
+}
+
+func displayEC2DetailsCmd(clients ClientFactory) *cobra.Command {
+	var consoleLines int
+
+	cmd := &cobra.Command{
+		Use:   "display-ec2 [instance-id]",
+		Short: "Display the network, security groups, volumes, status checks and console output of an EC2 instance",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Instance ID is required")
+			}
+			instanceID := args[0]
+			ctx := cmd.Context()
+
+			client, err := clients.EC2(ctx)
+			if err != nil {
+				return err
+			}
+			inst, err := describeInstance(ctx, client, instanceID)
+			if err != nil {
+				return err
+			}
+
+			detail := newInstanceDetail(inst)
+			// the extra lookups only add context, so their failures are
+			// warnings rather than errors
+			warn := func(err error) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "⚠️ %v\n", err)
+			}
+			if err := detail.addSecurityGroups(ctx, client, inst); err != nil {
+				warn(err)
+			}
+			if err := detail.addVolumes(ctx, client, inst); err != nil {
+				warn(err)
+			}
+			if err := detail.addStatus(ctx, client); err != nil {
+				warn(err)
+			}
+			if consoleLines > 0 {
+				if err := detail.addConsoleOutput(ctx, client, consoleLines); err != nil {
+					warn(err)
+				}
+			}
+
+			if output := printer.Output(cmd); !printer.IsTable(output) {
+				return printer.PrintAll(cmd.OutOrStdout(), output, instanceDetailColumns, []instanceDetail{detail})
+			}
+			return printInstanceDetail(cmd.OutOrStdout(), detail)
+		},
+	}
+
+	cmd.Flags().IntVar(&consoleLines, "console-lines", 20, "Number of console output lines to show; 0 skips the console output")
+	return cmd
+}
+
+func newInstanceDetail(inst ec2types.Instance) instanceDetail {
+	d := instanceDetail{
+		instanceRecord: newInstanceRecord(inst),
+		VpcID:          aws.ToString(inst.VpcId),
+		SubnetID:       aws.ToString(inst.SubnetId),
+		Tags:           map[string]string{},
+	}
+	if inst.IamInstanceProfile != nil {
+		d.InstanceProfile = aws.ToString(inst.IamInstanceProfile.Arn)
+	}
+	for _, t := range inst.Tags {
+		d.Tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+	}
+	for _, eni := range inst.NetworkInterfaces {
+		n := networkInterface{
+			ID:       aws.ToString(eni.NetworkInterfaceId),
+			SubnetID: aws.ToString(eni.SubnetId),
+		}
+		for _, ip := range eni.PrivateIpAddresses {
+			n.PrivateIPs = append(n.PrivateIPs, aws.ToString(ip.PrivateIpAddress))
+		}
+		if eni.Association != nil {
+			n.PublicIP = aws.ToString(eni.Association.PublicIp)
+		}
+		d.NetworkInterfaces = append(d.NetworkInterfaces, n)
+	}
+	return d
+}
+
+func (d *instanceDetail) addSecurityGroups(ctx context.Context, client EC2API, inst ec2types.Instance) error {
+	var ids []string
+	for _, g := range inst.SecurityGroups {
+		ids = append(ids, aws.ToString(g.GroupId))
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	out, err := client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: ids})
+	if err != nil {
+		return awsError(err, "Failed to describe security groups")
+	}
+	for _, g := range out.SecurityGroups {
+		group := securityGroup{ID: aws.ToString(g.GroupId), Name: aws.ToString(g.GroupName)}
+		for _, p := range g.IpPermissions {
+			group.Inbound = append(group.Inbound, ingressRules(p)...)
+		}
+		d.SecurityGroups = append(d.SecurityGroups, group)
+	}
+	return nil
+}
+
+// ingressRules flattens a permission into one rule per source.
+func ingressRules(p ec2types.IpPermission) []ingressRule {
+	protocol := aws.ToString(p.IpProtocol)
+	if protocol == "-1" {
+		protocol = "all"
+	}
+	ports := "all"
+	if from, to := aws.ToInt32(p.FromPort), aws.ToInt32(p.ToPort); p.FromPort != nil && from != -1 {
+		ports = fmt.Sprint(from)
+		if to != from {
+			ports = fmt.Sprintf("%d-%d", from, to)
+		}
+	}
+
+	var sources []string
+	for _, r := range p.IpRanges {
+		sources = append(sources, aws.ToString(r.CidrIp))
+	}
+	for _, r := range p.Ipv6Ranges {
+		sources = append(sources, aws.ToString(r.CidrIpv6))
+	}
+	for _, g := range p.UserIdGroupPairs {
+		sources = append(sources, aws.ToString(g.GroupId))
+	}
+	for _, l := range p.PrefixListIds {
+		sources = append(sources, aws.ToString(l.PrefixListId))
+	}
+
+	var rules []ingressRule
+	for _, source := range sources {
+		rules = append(rules, ingressRule{Protocol: protocol, Ports: ports, Source: source})
+	}
+	return rules
+}
+
+func (d *instanceDetail) addVolumes(ctx context.Context, client EC2API, inst ec2types.Instance) error {
+	devices := map[string]string{}
+	var ids []string
+	for _, m := range inst.BlockDeviceMappings {
+		if m.Ebs == nil {
+			continue
+		}
+		id := aws.ToString(m.Ebs.VolumeId)
+		devices[id] = aws.ToString(m.DeviceName)
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	out, err := client.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{VolumeIds: ids})
+	if err != nil {
+		return awsError(err, "Failed to describe volumes")
+	}
+	for _, v := range out.Volumes {
+		id := aws.ToString(v.VolumeId)
+		d.Volumes = append(d.Volumes, volume{
+			ID:        id,
+			Device:    devices[id],
+			SizeGiB:   aws.ToInt32(v.Size),
+			Type:      string(v.VolumeType),
+			Encrypted: aws.ToBool(v.Encrypted),
+		})
+	}
+	return nil
+}
+
+func (d *instanceDetail) addStatus(ctx context.Context, client EC2API) error {
+	out, err := client.DescribeInstanceStatus(ctx, &ec2.DescribeInstanceStatusInput{
+		InstanceIds:         []string{d.InstanceID},
+		IncludeAllInstances: aws.Bool(true),
+	})
+	if err != nil {
+		return awsError(err, "Failed to describe instance status")
+	}
+	for _, s := range out.InstanceStatuses {
+		if s.SystemStatus != nil {
+			d.SystemStatus = string(s.SystemStatus.Status)
+		}
+		if s.InstanceStatus != nil {
+			d.InstanceStatus = string(s.InstanceStatus.Status)
+		}
+	}
+	return nil
+}
+
+// addConsoleOutput keeps the last n lines of the console output.
+func (d *instanceDetail) addConsoleOutput(ctx context.Context, client EC2API, n int) error {
+	out, err := client.GetConsoleOutput(ctx, &ec2.GetConsoleOutputInput{InstanceId: aws.String(d.InstanceID)})
+	if err != nil {
+		return awsError(err, "Failed to get console output")
+	}
+	data, err := base64.StdEncoding.DecodeString(aws.ToString(out.Output))
+	if err != nil {
+		return clierr.Wrap(clierr.KindRemote, err, "Invalid console output")
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	d.ConsoleOutput = strings.Join(lines, "\n")
+	return nil
+}
+
+// printInstanceDetail writes the human-readable form of display-ec2.
+func printInstanceDetail(out io.Writer, d instanceDetail) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Instance ID:\t%s\n", d.InstanceID)
+	fmt.Fprintf(w, "Name:\t%s\n", printer.Or(d.Name))
+	fmt.Fprintf(w, "State:\t%s\n", d.State)
+	fmt.Fprintf(w, "Status checks:\tsystem %s, instance %s\n", printer.Or(d.SystemStatus), printer.Or(d.InstanceStatus))
+	fmt.Fprintf(w, "Type:\t%s\n", d.Type)
+	fmt.Fprintf(w, "AMI:\t%s\n", printer.Or(d.ImageID))
+	fmt.Fprintf(w, "AZ:\t%s\n", printer.Or(d.AvailabilityZone))
+	fmt.Fprintf(w, "VPC / subnet:\t%s / %s\n", printer.Or(d.VpcID), printer.Or(d.SubnetID))
+	fmt.Fprintf(w, "Private IP:\t%s\n", printer.Or(d.PrivateIP))
+	fmt.Fprintf(w, "Public IP:\t%s\n", printer.Or(d.PublicIP))
+	fmt.Fprintf(w, "Instance profile:\t%s\n", printer.Or(d.InstanceProfile))
+	fmt.Fprintf(w, "Launched:\t%s\n", printer.Time(d.LaunchTime))
+
+	if len(d.NetworkInterfaces) > 0 {
+		fmt.Fprintln(w, "\nNetwork interfaces:")
+		for _, n := range d.NetworkInterfaces {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", n.ID, n.SubnetID, strings.Join(n.PrivateIPs, ","), printer.Or(n.PublicIP))
+		}
+	}
+	if len(d.SecurityGroups) > 0 {
+		fmt.Fprintln(w, "\nSecurity groups:")
+		for _, g := range d.SecurityGroups {
+			fmt.Fprintf(w, "  %s (%s)\n", g.ID, g.Name)
+			for _, r := range g.Inbound {
+				fmt.Fprintf(w, "    %s\t%s\tfrom %s\n", r.Protocol, r.Ports, r.Source)
+			}
+		}
+	}
+	if len(d.Volumes) > 0 {
+		fmt.Fprintln(w, "\nVolumes:")
+		for _, v := range d.Volumes {
+			encryption := "unencrypted"
+			if v.Encrypted {
+				encryption = "encrypted"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%d GiB\t%s\t%s\n", v.ID, v.Device, v.SizeGiB, v.Type, encryption)
+		}
+	}
+	if len(d.Tags) > 0 {
+		fmt.Fprintln(w, "\nTags:")
+		for _, k := range sortedKeys(d.Tags) {
+			fmt.Fprintf(w, "  %s\t%s\n", k, d.Tags[k])
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if d.ConsoleOutput != "" {
+		fmt.Fprintf(out, "\nConsole output (tail):\n%s\n", d.ConsoleOutput)
+	}
+	return nil
+}
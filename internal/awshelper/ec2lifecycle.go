@@ -0,0 +1,303 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"devctl/pkg/progress"
+	"devctl/pkg/prompt"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+)
+
+// instanceAction is one of the EC2 lifecycle commands.
+type instanceAction struct {
+	name  string
+	title string
+	verb  string
+	// done describes the instances once the action finished, e.g. "stopped"
+	done string
+	// target is the state the action leads to; instances already in it
+	// are skipped
+	target ec2types.InstanceStateName
+	// confirm asks before acting unless --yes is given
+	confirm bool
+	// long is the command's help text, when Short needs explaining
+	long string
+	run  func(ctx context.Context, client EC2API, ids []string) error
+	wait func(ctx context.Context, client EC2API, ids []string, timeout time.Duration, update func(string)) error
+}
+
+var startInstances = instanceAction{
+	name:   "start",
+	title:  "Start",
+	verb:   "Starting",
+	done:   "running",
+	target: ec2types.InstanceStateNameRunning,
+	run: func(ctx context.Context, client EC2API, ids []string) error {
+		_, err := client.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: ids})
+		return err
+	},
+	wait: func(ctx context.Context, client EC2API, ids []string, timeout time.Duration, update func(string)) error {
+		return ec2.NewInstanceRunningWaiter(client, func(o *ec2.InstanceRunningWaiterOptions) {
+			o.MinDelay = pollInterval
+			o.Retryable = reportStates(o.Retryable, ec2types.InstanceStateNameRunning, update)
+		}).Wait(ctx, &ec2.DescribeInstancesInput{InstanceIds: ids}, timeout)
+	},
+}
+
+var stopInstances = instanceAction{
+	name:   "stop",
+	title:  "Stop",
+	verb:   "Stopping",
+	done:   "stopped",
+	target: ec2types.InstanceStateNameStopped,
+	run: func(ctx context.Context, client EC2API, ids []string) error {
+		_, err := client.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: ids})
+		return err
+	},
+	wait: func(ctx context.Context, client EC2API, ids []string, timeout time.Duration, update func(string)) error {
+		return ec2.NewInstanceStoppedWaiter(client, func(o *ec2.InstanceStoppedWaiterOptions) {
+			o.MinDelay = pollInterval
+			o.Retryable = reportStates(o.Retryable, ec2types.InstanceStateNameStopped, update)
+		}).Wait(ctx, &ec2.DescribeInstancesInput{InstanceIds: ids}, timeout)
+	},
+}
+
+// rebootGrace is how long reboot-ec2 waits for the status checks to notice
+// a reboot. EC2 runs the checks about once a minute, so a quick reboot can
+// finish without them ever failing.
+var rebootGrace = 2 * time.Minute
+
+// rebooting doesn't change the state, so reboot-ec2 waits for the status
+// checks to stop passing and then to pass again
+var rebootInstances = instanceAction{
+	name:  "reboot",
+	title: "Reboot",
+	verb:  "Rebooting",
+	done:  "passing status checks",
+	long: `Reboot instances and wait until their status checks pass again.
+
+The checks still pass right after the reboot request. devctl waits up to two
+minutes for them to notice the reboot; a reboot quick enough to go unnoticed
+counts as done, so the wait is best effort.`,
+	run: func(ctx context.Context, client EC2API, ids []string) error {
+		_, err := client.RebootInstances(ctx, &ec2.RebootInstancesInput{InstanceIds: ids})
+		return err
+	},
+	wait: func(ctx context.Context, client EC2API, ids []string, timeout time.Duration, update func(string)) error {
+		deadline := time.Now().Add(min(rebootGrace, timeout))
+		for {
+			out, err := client.DescribeInstanceStatus(ctx, &ec2.DescribeInstanceStatusInput{
+				InstanceIds:         ids,
+				IncludeAllInstances: aws.Bool(true),
+			})
+			if err != nil {
+				return err
+			}
+			if statusOk(out.InstanceStatuses) < len(ids) || !time.Now().Before(deadline) {
+				break
+			}
+			update("waiting for the reboot")
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pollInterval):
+			}
+		}
+
+		return ec2.NewInstanceStatusOkWaiter(client, func(o *ec2.InstanceStatusOkWaiterOptions) {
+			o.MinDelay = pollInterval
+			retryable := o.Retryable
+			o.Retryable = func(ctx context.Context, in *ec2.DescribeInstanceStatusInput, out *ec2.DescribeInstanceStatusOutput, err error) (bool, error) {
+				if out != nil {
+					update(fmt.Sprintf("%d/%d status ok", statusOk(out.InstanceStatuses), len(ids)))
+				}
+				return retryable(ctx, in, out, err)
+			}
+		}).Wait(ctx, &ec2.DescribeInstanceStatusInput{InstanceIds: ids}, timeout)
+	},
+}
+
+// statusOk counts the instances whose instance status check passes.
+func statusOk(statuses []ec2types.InstanceStatus) int {
+	var ok int
+	for _, s := range statuses {
+		if s.InstanceStatus != nil && s.InstanceStatus.Status == ec2types.SummaryStatusOk {
+			ok++
+		}
+	}
+	return ok
+}
+
+var terminateInstances = instanceAction{
+	name:    "terminate",
+	title:   "Terminate",
+	verb:    "Terminating",
+	done:    "terminated",
+	target:  ec2types.InstanceStateNameTerminated,
+	confirm: true,
+	run: func(ctx context.Context, client EC2API, ids []string) error {
+		_, err := client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{InstanceIds: ids})
+		return err
+	},
+	wait: func(ctx context.Context, client EC2API, ids []string, timeout time.Duration, update func(string)) error {
+		return ec2.NewInstanceTerminatedWaiter(client, func(o *ec2.InstanceTerminatedWaiterOptions) {
+			o.MinDelay = pollInterval
+			o.Retryable = reportStates(o.Retryable, ec2types.InstanceStateNameTerminated, update)
+		}).Wait(ctx, &ec2.DescribeInstancesInput{InstanceIds: ids}, timeout)
+	},
+}
+
+// reportStates wraps the retry check of a DescribeInstances waiter to report
+// how many instances reached want.
+func reportStates(retryable func(context.Context, *ec2.DescribeInstancesInput, *ec2.DescribeInstancesOutput, error) (bool, error),
+	want ec2types.InstanceStateName, update func(string)) func(context.Context, *ec2.DescribeInstancesInput, *ec2.DescribeInstancesOutput, error) (bool, error) {
+	return func(ctx context.Context, in *ec2.DescribeInstancesInput, out *ec2.DescribeInstancesOutput, err error) (bool, error) {
+		if out != nil {
+			var total, reached int
+			for _, res := range out.Reservations {
+				for _, inst := range res.Instances {
+					total++
+					if inst.State != nil && inst.State.Name == want {
+						reached++
+					}
+				}
+			}
+			update(fmt.Sprintf("%d/%d %s", reached, total, want))
+		}
+		return retryable(ctx, in, out, err)
+	}
+}
+
+func instanceActionCmd(clients ClientFactory, action instanceAction) *cobra.Command {
+	var filter instanceFilter
+	var dryRun, yes, noWait bool
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   action.name + "-ec2 [instance-id...]",
+		Short: fmt.Sprintf("%s EC2 instances by ID or tag", action.title),
+		Long:  action.long,
+		Example: fmt.Sprintf(`  devctl aws %[1]s-ec2 i-0123456789abcdef0 i-0fedcba9876543210
+  devctl aws %[1]s-ec2 --tag env=dev --name 'sandbox-*'`, action.name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && filter.empty() {
+				return clierr.New(clierr.KindInput, "Instance IDs or a selector (--tag, --name, --state, --vpc, --subnet) are required")
+			}
+			filters, err := filter.filters()
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			ctx := cmd.Context()
+
+			client, err := clients.EC2(ctx)
+			if err != nil {
+				return err
+			}
+			instances, err := selectInstances(ctx, client, args, filters)
+			if err != nil {
+				return err
+			}
+
+			var affected []instanceRecord
+			var ids []string
+			for _, inst := range instances {
+				r := newInstanceRecord(inst)
+				if ec2types.InstanceStateName(r.State) == ec2types.InstanceStateNameTerminated ||
+					action.target != "" && ec2types.InstanceStateName(r.State) == action.target {
+					fmt.Fprintf(cmd.ErrOrStderr(), "⚠️ Skipping %s: already %s\n", r.InstanceID, r.State)
+					continue
+				}
+				affected = append(affected, r)
+				ids = append(ids, r.InstanceID)
+			}
+			if len(affected) == 0 {
+				fmt.Fprintln(out, "✅ No instances to "+action.name+".")
+				return nil
+			}
+
+			if err := printer.PrintAll(out, printer.FormatTable, instanceColumns, affected); err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Fprintf(out, "\n🔍 Dry run: would %s %d instances.\n", action.name, len(ids))
+				return nil
+			}
+			if action.confirm && !yes {
+				ok, err := prompt.ConfirmText(cmd.InOrStdin(), cmd.ErrOrStderr(),
+					fmt.Sprintf("%s these %d instances?", action.title, len(ids)), action.name)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return clierr.New(clierr.KindAborted, "%s cancelled", action.title)
+				}
+			}
+
+			if err := action.run(ctx, client, ids); err != nil {
+				return awsError(err, "Failed to %s instances", action.name)
+			}
+			if noWait {
+				fmt.Fprintf(out, "✅ %s %d instances.\n", action.verb, len(ids))
+				return nil
+			}
+			return waitForInstances(ctx, cmd.ErrOrStderr(), client, action, ids, timeout)
+		},
+	}
+
+	filter.register(cmd)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the affected instances without changing them")
+	if action.confirm {
+		cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+	}
+	cmd.Flags().BoolVar(&noWait, "no-wait", false, "Return without waiting for the instances to settle")
+	cmd.Flags().DurationVar(&timeout, "timeout", 15*time.Minute, "How long to wait for the instances to settle")
+	return cmd
+}
+
+// selectInstances returns the instances with the given IDs that match
+// filters; without IDs, every instance matching filters.
+func selectInstances(ctx context.Context, client EC2API, ids []string, filters []ec2types.Filter) ([]ec2types.Instance, error) {
+	paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+		InstanceIds: ids,
+		Filters:     filters,
+	})
+	var instances []ec2types.Instance
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, awsError(err, "Failed to describe instances")
+		}
+		for _, res := range page.Reservations {
+			instances = append(instances, res.Instances...)
+		}
+	}
+	if len(instances) == 0 {
+		return nil, clierr.New(clierr.KindNotFound, "No instances match")
+	}
+	return instances, nil
+}
+
+func waitForInstances(ctx context.Context, w io.Writer, client EC2API, action instanceAction, ids []string, timeout time.Duration) error {
+	bar := progress.New(w, fmt.Sprintf("%s %d instances", action.verb, len(ids)))
+	if err := action.wait(ctx, client, ids, timeout, bar.Update); err != nil {
+		bar.Done("failed")
+		kind := clierr.KindRemote
+		if errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "exceeded max wait time") {
+			kind = clierr.KindTimeout
+		}
+		return clierr.Wrap(kind, err, "Instances did not finish %s", strings.ToLower(action.verb))
+	}
+	bar.Done(action.done)
+	return nil
+}
@@ -0,0 +1,74 @@
+package awshelper
+
+import (
+	"devctl/pkg/clierr"
+	"errors"
+	"net/http"
+	"strings"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// awsError wraps an SDK error with a message and the matching error kind.
+func awsError(err error, format string, args ...interface{}) error {
+	return clierr.Wrap(classifyAWSError(err), err, format, args...)
+}
+
+// errorCode returns the AWS error code of err, or "" when it has none.
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+// classifyAWSError maps AWS error codes onto the devctl error taxonomy.
+func classifyAWSError(err error) clierr.Kind {
+	if kind := clierr.KindOf(err); kind != clierr.KindUnknown {
+		return kind
+	}
+
+	// Credential resolution failures are not typed; the SDK only wraps them
+	// with a fixed message before the request is signed.
+	var signErr *v4.SigningError
+	if errors.As(err, &signErr) || strings.Contains(err.Error(), "get identity: ") {
+		return clierr.KindAuth
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		switch {
+		case code == "ValidationError" && strings.Contains(apiErr.ErrorMessage(), "does not exist"):
+			return clierr.KindNotFound
+		case code == "ValidationError" || code == "InvalidParameterValue" || code == "InvalidParameterCombination" ||
+			strings.HasSuffix(code, ".Malformed"):
+			return clierr.KindInput
+		case strings.HasPrefix(code, "NoSuch") || strings.HasSuffix(code, "NotFound") ||
+			strings.HasSuffix(code, "NotFoundException"):
+			return clierr.KindNotFound
+		case strings.HasPrefix(code, "AccessDenied") || strings.HasPrefix(code, "ExpiredToken") ||
+			strings.HasPrefix(code, "InvalidClientTokenId") || strings.HasPrefix(code, "UnrecognizedClient") ||
+			code == "InvalidAccessKeyId" || code == "SignatureDoesNotMatch" || code == "UnauthorizedOperation" ||
+			code == "AuthFailure" || code == "RequestExpired" || code == "InvalidToken":
+			return clierr.KindAuth
+		case strings.HasPrefix(code, "RequestTimeout"):
+			return clierr.KindTimeout
+		}
+	}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return clierr.KindNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return clierr.KindAuth
+		}
+	}
+
+	return clierr.KindRemote
+}
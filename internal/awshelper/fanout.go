@@ -0,0 +1,233 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/spf13/cobra"
+)
+
+// origin records the account and region a record was listed from. It is
+// embedded in the records of commands that can fan out.
+type origin struct {
+	Account string `json:"account,omitempty"`
+	Region  string `json:"region,omitempty"`
+}
+
+func (o origin) where() origin { return o }
+
+func (o origin) String() string {
+	account, region := o.Account, o.Region
+	if account == "" {
+		account = "default"
+	}
+	if region == "" {
+		return account
+	}
+	return account + "/" + region
+}
+
+// target is one account and region queried by a fanned-out command.
+type target struct {
+	origin
+	clients ClientFactory
+}
+
+// fanoutFlags holds the flags that spread a list command across accounts
+// and regions.
+type fanoutFlags struct {
+	allRegions  bool
+	accounts    []string
+	concurrency int
+}
+
+func (f *fanoutFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.allRegions, "all-regions", false, "Query every region enabled in the account")
+	cmd.Flags().StringSliceVar(&f.accounts, "accounts", nil, "Comma-separated profiles or role ARNs to query instead of the current credentials")
+	cmd.Flags().IntVar(&f.concurrency, "concurrency", 8, "Maximum number of accounts and regions queried at once")
+}
+
+func (f *fanoutFlags) enabled() bool {
+	return f.allRegions || len(f.accounts) > 0
+}
+
+// validate rejects flag combinations that make no sense across targets.
+func (f *fanoutFlags) validate(pages *pageFlags) error {
+	if f.concurrency < 1 {
+		return clierr.New(clierr.KindInput, "--concurrency must be at least 1")
+	}
+	if pages.maxItems > 0 || pages.startingToken != "" {
+		return clierr.New(clierr.KindInput, "--max-items and --starting-token cannot be combined with --all-regions or --accounts")
+	}
+	return nil
+}
+
+// targets expands the flags into the accounts and regions to query. For
+// global services (regional is false) there is one target per account.
+func (f *fanoutFlags) targets(ctx context.Context, cmd *cobra.Command, clients ClientFactory, regional bool) ([]target, error) {
+	accounts := []target{{clients: clients}}
+	if len(f.accounts) > 0 {
+		accounts = nil
+		for _, account := range f.accounts {
+			accounts = append(accounts, target{
+				origin:  origin{Account: accountName(account)},
+				clients: clients.ForAccount(account),
+			})
+		}
+	}
+	if !regional || !f.allRegions {
+		return accounts, nil
+	}
+
+	return fanOut(ctx, cmd, f.concurrency, accounts, func(ctx context.Context, t target) ([]target, error) {
+		client, err := t.clients.EC2(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out, err := client.DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+		if err != nil {
+			return nil, awsError(err, "Unable to list regions")
+		}
+		var regions []target
+		for _, r := range out.Regions {
+			name := aws.ToString(r.RegionName)
+			regions = append(regions, target{
+				origin:  origin{Account: t.Account, Region: name},
+				clients: t.clients.ForRegion(name),
+			})
+		}
+		sort.Slice(regions, func(i, j int) bool { return regions[i].Region < regions[j].Region })
+		return regions, nil
+	})
+}
+
+// accountName is the label of an --accounts entry: the account ID of a role
+// ARN, or the profile name.
+func accountName(account string) string {
+	if parts := strings.Split(account, ":"); strings.HasPrefix(account, "arn:") && len(parts) > 4 && parts[4] != "" {
+		return parts[4]
+	}
+	return account
+}
+
+// fanOut calls fn for every target with at most concurrency calls in flight
+// and returns the results in target order. Failed targets are reported on
+// stderr as they finish; the results of the others are still returned,
+// together with an error saying how many failed.
+func fanOut[T any](ctx context.Context, cmd *cobra.Command, concurrency int, targets []target,
+	fn func(context.Context, target) ([]T, error)) ([]T, error) {
+	results := make([][]T, len(targets))
+	errs := make([]error, len(targets))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i], errs[i] = fn(ctx, t)
+			if errs[i] != nil {
+				mu.Lock()
+				fmt.Fprintf(cmd.ErrOrStderr(), "⚠️ %s: %v\n", t.origin, errs[i])
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var all []T
+	var failed int
+	var first error
+	for i := range targets {
+		all = append(all, results[i]...)
+		if errs[i] != nil {
+			failed++
+			if first == nil {
+				first = errs[i]
+			}
+		}
+	}
+	if failed > 0 {
+		return all, clierr.Wrap(clierr.KindOf(first), first, "%d of %d targets failed", failed, len(targets))
+	}
+	return all, nil
+}
+
+// listFunc streams the records of one target to emit, calling flush after
+// every page.
+type listFunc[T any] func(ctx context.Context, t target, start pageStart, emit func(T) error, flush func() error) error
+
+// runList prints the records of list for the current credentials or, with
+// the fan-out flags, for every account and region merged into one listing
+// with Account and Region columns.
+func runList[T interface{ where() origin }](cmd *cobra.Command, clients ClientFactory, pages *pageFlags,
+	fan *fanoutFlags, regional bool, cols []printer.Column[T], list listFunc[T]) error {
+	ctx := cmd.Context()
+
+	if !fan.enabled() {
+		start, err := pages.start()
+		if err != nil {
+			return err
+		}
+		p, err := printer.New(cmd.OutOrStdout(), printer.Output(cmd), cols)
+		if err != nil {
+			return err
+		}
+		if err := list(ctx, target{clients: clients}, start, p.Print, p.Sync); err != nil {
+			return err
+		}
+		return p.Flush()
+	}
+
+	if err := fan.validate(pages); err != nil {
+		return err
+	}
+	p, err := printer.New(cmd.OutOrStdout(), printer.Output(cmd), originColumns(cols, len(fan.accounts) > 0, fan.allRegions))
+	if err != nil {
+		return err
+	}
+	targets, targetsErr := fan.targets(ctx, cmd, clients, regional)
+	records, err := fanOut(ctx, cmd, fan.concurrency, targets, func(ctx context.Context, t target) ([]T, error) {
+		var records []T
+		err := list(ctx, t, pageStart{}, func(r T) error {
+			records = append(records, r)
+			return nil
+		}, func() error { return nil })
+		return records, err
+	})
+	for _, r := range records {
+		if err := p.Print(r); err != nil {
+			return err
+		}
+	}
+	if err := p.Flush(); err != nil {
+		return err
+	}
+	if targetsErr != nil {
+		return targetsErr
+	}
+	return err
+}
+
+// originColumns puts Account and Region columns in front of cols.
+func originColumns[T interface{ where() origin }](cols []printer.Column[T], account, region bool) []printer.Column[T] {
+	var out []printer.Column[T]
+	if account {
+		out = append(out, printer.Column[T]{Header: "Account", Value: func(r T) string { return printer.Or(r.where().Account) }})
+	}
+	if region {
+		out = append(out, printer.Column[T]{Header: "Region", Value: func(r T) string { return printer.Or(r.where().Region) }})
+	}
+	return append(out, cols...)
+}
@@ -0,0 +1,247 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/spf13/cobra"
+)
+
+type iamUserRecord struct {
+	Name    string     `json:"name"`
+	UserID  string     `json:"userId"`
+	Arn     string     `json:"arn"`
+	Created *time.Time `json:"created,omitempty"`
+}
+
+var iamUserColumns = []printer.Column[iamUserRecord]{
+	{Header: "Name", Value: func(u iamUserRecord) string { return u.Name }},
+	{Header: "User ID", Value: func(u iamUserRecord) string { return u.UserID }},
+	{Header: "Created", Value: func(u iamUserRecord) string { return printer.Time(u.Created) }},
+	{Header: "ARN", Wide: true, Value: func(u iamUserRecord) string { return u.Arn }},
+}
+
+// List IAM Users
+func listIAMUsersCmd(clients ClientFactory) *cobra.Command {
+	var pages pageFlags
+
+	cmd := &cobra.Command{
+		Use:   "list-iam-users",
+		Short: "List IAM users",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			start, err := pages.start()
+			if err != nil {
+				return err
+			}
+			p, err := printer.New(cmd.OutOrStdout(), printer.Output(cmd), iamUserColumns)
+			if err != nil {
+				return err
+			}
+			client, err := clients.IAM(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			paginator := iam.NewListUsersPaginator(client, &iam.ListUsersInput{Marker: start.token},
+				func(o *iam.ListUsersPaginatorOptions) { o.Limit = pages.limit(1, 1000) })
+			err = paginate(cmd.Context(), cmd, &pages, start, paginator.HasMorePages,
+				func(ctx context.Context) ([]iamtypes.User, *string, error) {
+					page, err := paginator.NextPage(ctx)
+					if err != nil {
+						return nil, nil, awsError(err, "Unable to list IAM users")
+					}
+					return page.Users, page.Marker, nil
+				},
+				func(user iamtypes.User) error {
+					return p.Print(iamUserRecord{
+						Name:    aws.ToString(user.UserName),
+						UserID:  aws.ToString(user.UserId),
+						Arn:     aws.ToString(user.Arn),
+						Created: user.CreateDate,
+					})
+				}, p.Sync)
+			if err != nil {
+				return err
+			}
+			return p.Flush()
+		},
+	}
+
+	pages.register(cmd, true)
+	return cmd
+}
+
+type iamRoleRecord struct {
+	Name    string     `json:"name"`
+	Path    string     `json:"path"`
+	Arn     string     `json:"arn"`
+	Created *time.Time `json:"created,omitempty"`
+}
+
+var iamRoleColumns = []printer.Column[iamRoleRecord]{
+	{Header: "Name", Value: func(r iamRoleRecord) string { return r.Name }},
+	{Header: "Path", Value: func(r iamRoleRecord) string { return r.Path }},
+	{Header: "Created", Value: func(r iamRoleRecord) string { return printer.Time(r.Created) }},
+	{Header: "ARN", Wide: true, Value: func(r iamRoleRecord) string { return r.Arn }},
+}
+
+// List IAM Roles
+func listIAMRolesCmd(clients ClientFactory) *cobra.Command {
+	var pages pageFlags
+
+	cmd := &cobra.Command{
+		Use:   "list-iam-roles",
+		Short: "List IAM roles",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			start, err := pages.start()
+			if err != nil {
+				return err
+			}
+			p, err := printer.New(cmd.OutOrStdout(), printer.Output(cmd), iamRoleColumns)
+			if err != nil {
+				return err
+			}
+			client, err := clients.IAM(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			paginator := iam.NewListRolesPaginator(client, &iam.ListRolesInput{Marker: start.token},
+				func(o *iam.ListRolesPaginatorOptions) { o.Limit = pages.limit(1, 1000) })
+			err = paginate(cmd.Context(), cmd, &pages, start, paginator.HasMorePages,
+				func(ctx context.Context) ([]iamtypes.Role, *string, error) {
+					page, err := paginator.NextPage(ctx)
+					if err != nil {
+						return nil, nil, awsError(err, "Unable to list IAM roles")
+					}
+					return page.Roles, page.Marker, nil
+				},
+				func(role iamtypes.Role) error {
+					return p.Print(iamRoleRecord{
+						Name:    aws.ToString(role.RoleName),
+						Path:    aws.ToString(role.Path),
+						Arn:     aws.ToString(role.Arn),
+						Created: role.CreateDate,
+					})
+				}, p.Sync)
+			if err != nil {
+				return err
+			}
+			return p.Flush()
+		},
+	}
+
+	pages.register(cmd, true)
+	return cmd
+}
+
+type iamPolicyRecord struct {
+	Name        string `json:"name"`
+	Arn         string `json:"arn"`
+	Attachments int32  `json:"attachments"`
+}
+
+var iamPolicyColumns = []printer.Column[iamPolicyRecord]{
+	{Header: "Name", Value: func(p iamPolicyRecord) string { return p.Name }},
+	{Header: "Attachments", Value: func(p iamPolicyRecord) string { return strconv.Itoa(int(p.Attachments)) }},
+	{Header: "ARN", Wide: true, Value: func(p iamPolicyRecord) string { return p.Arn }},
+}
+
+var attachedPolicyColumns = []printer.Column[iamPolicyRecord]{
+	{Header: "Name", Value: func(p iamPolicyRecord) string { return p.Name }},
+	{Header: "ARN", Value: func(p iamPolicyRecord) string { return p.Arn }},
+}
+
+// List IAM Policies
+func listIAMPoliciesCmd(clients ClientFactory) *cobra.Command {
+	var pages pageFlags
+
+	cmd := &cobra.Command{
+		Use:   "list-iam-policies",
+		Short: "List IAM policies",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			start, err := pages.start()
+			if err != nil {
+				return err
+			}
+			p, err := printer.New(cmd.OutOrStdout(), printer.Output(cmd), iamPolicyColumns)
+			if err != nil {
+				return err
+			}
+			client, err := clients.IAM(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			paginator := iam.NewListPoliciesPaginator(client, &iam.ListPoliciesInput{Marker: start.token},
+				func(o *iam.ListPoliciesPaginatorOptions) { o.Limit = pages.limit(1, 1000) })
+			err = paginate(cmd.Context(), cmd, &pages, start, paginator.HasMorePages,
+				func(ctx context.Context) ([]iamtypes.Policy, *string, error) {
+					page, err := paginator.NextPage(ctx)
+					if err != nil {
+						return nil, nil, awsError(err, "Unable to list IAM policies")
+					}
+					return page.Policies, page.Marker, nil
+				},
+				func(policy iamtypes.Policy) error {
+					return p.Print(iamPolicyRecord{
+						Name:        aws.ToString(policy.PolicyName),
+						Arn:         aws.ToString(policy.Arn),
+						Attachments: aws.ToInt32(policy.AttachmentCount),
+					})
+				}, p.Sync)
+			if err != nil {
+				return err
+			}
+			return p.Flush()
+		},
+	}
+
+	pages.register(cmd, true)
+	return cmd
+}
+
+// Display IAM Policies of a Role
+func displayIAMRolePoliciesCmd(clients ClientFactory) *cobra.Command {
+	return &cobra.Command{
+		Use:   "display-iam-role-policies",
+		Short: "Display IAM policies of a role",
+		Long: `List the managed policies attached to a role. "iam policies role/NAME" also
+shows their documents and the role's inline policies.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Role name is required")
+			}
+			roleName := args[0]
+
+			client, err := clients.IAM(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			var records []iamPolicyRecord
+			paginator := iam.NewListAttachedRolePoliciesPaginator(client, &iam.ListAttachedRolePoliciesInput{
+				RoleName: aws.String(roleName),
+			})
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(cmd.Context())
+				if err != nil {
+					return awsError(err, "Unable to list policies for role %s", roleName)
+				}
+				for _, policy := range page.AttachedPolicies {
+					records = append(records, iamPolicyRecord{
+						Name: aws.ToString(policy.PolicyName),
+						Arn:  aws.ToString(policy.PolicyArn),
+					})
+				}
+			}
+			return printer.PrintAll(cmd.OutOrStdout(), printer.Output(cmd), attachedPolicyColumns, records)
+		},
+	}
+}
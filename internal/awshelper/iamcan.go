@@ -0,0 +1,229 @@
+package awshelper
+
+import (
+	"devctl/internal/iampolicy"
+	"devctl/pkg/clierr"
+	"devctl/pkg/color"
+	"devctl/pkg/printer"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/spf13/cobra"
+)
+
+// decidingStatement is a statement the simulator matched.
+type decidingStatement struct {
+	Policy string `json:"policy"`
+	// Type is the simulator's policy source type, e.g. "role" or "aws-managed".
+	Type      string          `json:"type"`
+	Line      int32           `json:"line"`
+	Sid       string          `json:"sid,omitempty"`
+	Summary   string          `json:"summary,omitempty"`
+	Statement json.RawMessage `json:"statement,omitempty"`
+}
+
+type accessDecision struct {
+	Principal string `json:"principal"`
+	Action    string `json:"action"`
+	Resource  string `json:"resource"`
+	// Decision is allowed, explicitDeny or implicitDeny.
+	Decision   string              `json:"decision"`
+	Statements []decidingStatement `json:"statements,omitempty"`
+	// BoundaryDenied means the permissions boundary does not allow the
+	// action, whatever the policies say.
+	BoundaryDenied bool     `json:"boundaryDenied,omitempty"`
+	MissingContext []string `json:"missingContext,omitempty"`
+}
+
+var accessDecisionColumns = []printer.Column[accessDecision]{
+	{Header: "Principal", Value: func(d accessDecision) string { return d.Principal }},
+	{Header: "Action", Value: func(d accessDecision) string { return d.Action }},
+	{Header: "Resource", Value: func(d accessDecision) string { return d.Resource }},
+	{Header: "Decision", Value: func(d accessDecision) string { return d.Decision }},
+}
+
+func iamCanCmd(clients ClientFactory) *cobra.Command {
+	return &cobra.Command{
+		Use:   "can <principal> <action> <resource>",
+		Short: "Check whether a role, user or group may perform an action on a resource",
+		Long: `Ask the IAM policy simulator whether the principal's policies allow the
+action on the resource, and show the statements that decided it.
+
+Only the principal's identity policies, those of a user's groups and its
+permissions boundary are evaluated; resource policies such as bucket
+policies, organization SCPs and session policies are not. Context keys the
+policies test, e.g. aws:SourceIp, are unknown to the simulator and reported.
+
+Exits with code 7 when the action is not allowed.`,
+		Example: `  devctl aws iam can role/deploy s3:PutObject arn:aws:s3:::builds/app.tar.gz
+  devctl aws iam can arn:aws:sts::111122223333:assumed-role/deploy/ci ec2:StopInstances '*'
+  devctl aws iam can user/alice kms:Decrypt arn:aws:kms:eu-west-1:111122223333:key/1234abcd -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 3 {
+				return clierr.New(clierr.KindInput, "Principal, action and resource are required")
+			}
+			principal, err := parsePrincipal(args[0])
+			if err != nil {
+				return err
+			}
+			action, resource := args[1], args[2]
+			ctx := cmd.Context()
+
+			client, err := clients.IAM(ctx)
+			if err != nil {
+				return err
+			}
+			if err := principal.resolveARN(ctx, client); err != nil {
+				return err
+			}
+			sim, err := client.SimulatePrincipalPolicy(ctx, &iam.SimulatePrincipalPolicyInput{
+				PolicySourceArn: aws.String(principal.arn),
+				ActionNames:     []string{action},
+				ResourceArns:    []string{resource},
+			})
+			if err != nil {
+				return awsError(err, "Failed to simulate %s for %s", action, principal)
+			}
+			if len(sim.EvaluationResults) == 0 {
+				return clierr.New(clierr.KindRemote, "The simulator returned no result for %s", action)
+			}
+			result := sim.EvaluationResults[0]
+
+			decision := accessDecision{
+				Principal:      principal.arn,
+				Action:         action,
+				Resource:       resource,
+				Decision:       string(result.EvalDecision),
+				MissingContext: result.MissingContextValues,
+			}
+			if b := result.PermissionsBoundaryDecisionDetail; b != nil && !b.AllowedByPermissionsBoundary {
+				decision.BoundaryDenied = true
+			}
+			if len(result.MatchedStatements) > 0 {
+				// the documents show what the matched statements say
+				docs, err := principalPolicies(ctx, client, principal)
+				if err != nil {
+					return err
+				}
+				for _, s := range result.MatchedStatements {
+					decision.Statements = append(decision.Statements, newDecidingStatement(s, docs))
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if output := printer.Output(cmd); !printer.IsTable(output) {
+				if err := printer.PrintAll(out, output, accessDecisionColumns, []accessDecision{decision}); err != nil {
+					return err
+				}
+			} else if err := printAccessDecision(out, decision); err != nil {
+				return err
+			}
+			if result.EvalDecision != iamtypes.PolicyEvaluationDecisionTypeAllowed {
+				return clierr.New(clierr.KindCheckFailed, "%s is not allowed to %s on %s", principal, action, resource)
+			}
+			return nil
+		},
+	}
+}
+
+func newDecidingStatement(s iamtypes.Statement, docs []policyDocument) decidingStatement {
+	d := decidingStatement{
+		Policy: aws.ToString(s.SourcePolicyId),
+		Type:   string(s.SourcePolicyType),
+	}
+	if s.StartPosition != nil {
+		d.Line = s.StartPosition.Line
+	}
+	for _, doc := range docs {
+		// the simulator prefixes inline policy names with their owner
+		if doc.Name != d.Policy && doc.Arn != d.Policy && !strings.HasSuffix(d.Policy, "_"+doc.Name) {
+			continue
+		}
+		raw, ok := statementAt(string(doc.Document), s.StartPosition)
+		if !ok {
+			break
+		}
+		var statement iampolicy.Statement
+		if err := json.Unmarshal(raw, &statement); err != nil {
+			break
+		}
+		explanation := statement.Explain()
+		d.Policy = doc.Name
+		d.Sid, d.Summary, d.Statement = explanation.Sid, explanation.Summary, raw
+		break
+	}
+	return d
+}
+
+// statementAt returns the statement object that starts at pos in document.
+// The object is read from the first "{" at or after pos, which also copes
+// with the column being counted from 0 or from 1.
+func statementAt(document string, pos *iamtypes.Position) (json.RawMessage, bool) {
+	if pos == nil {
+		return nil, false
+	}
+	lines := strings.SplitAfter(document, "\n")
+	line := int(pos.Line) - 1
+	if line < 0 || line >= len(lines) {
+		return nil, false
+	}
+	offset := len(strings.Join(lines[:line], "")) + max(int(pos.Column)-1, 0)
+	if offset >= len(document) {
+		return nil, false
+	}
+	start := strings.IndexByte(document[offset:], '{')
+	if start < 0 {
+		return nil, false
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(strings.NewReader(document[offset+start:])).Decode(&raw); err != nil {
+		return nil, false
+	}
+	return raw, true
+}
+
+func printAccessDecision(out io.Writer, d accessDecision) error {
+	paint := color.For(out)
+	decision := paint.Red(d.Decision)
+	if d.Decision == string(iamtypes.PolicyEvaluationDecisionTypeAllowed) {
+		decision = paint.Green(d.Decision)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Principal:\t%s\n", d.Principal)
+	fmt.Fprintf(w, "Action:\t%s\n", d.Action)
+	fmt.Fprintf(w, "Resource:\t%s\n", d.Resource)
+	fmt.Fprintf(w, "Decision:\t%s\n", decision)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	switch {
+	case len(d.Statements) > 0:
+		fmt.Fprintln(out, "\nDecided by:")
+		for _, s := range d.Statements {
+			title := fmt.Sprintf("Statement at line %d of %s policy %s", s.Line, s.Type, s.Policy)
+			if s.Sid != "" {
+				title = fmt.Sprintf("Statement %s at line %d of %s policy %s", s.Sid, s.Line, s.Type, s.Policy)
+			}
+			fmt.Fprintf(out, "  %s\n", paint.Bold(title))
+			if s.Summary != "" {
+				fmt.Fprintf(out, "  %s\n", s.Summary)
+			}
+		}
+	case d.Decision == string(iamtypes.PolicyEvaluationDecisionTypeImplicitDeny):
+		fmt.Fprintln(out, "\nNo statement allows it, so IAM denies it by default.")
+	}
+	if d.BoundaryDenied {
+		fmt.Fprintln(out, paint.Yellow("⚠️ The permissions boundary does not allow it."))
+	}
+	if len(d.MissingContext) > 0 {
+		fmt.Fprintln(out, paint.Yellow("⚠️ The decision depends on context the simulator was not given: "+strings.Join(d.MissingContext, ", ")))
+	}
+	return nil
+}
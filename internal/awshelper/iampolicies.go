@@ -0,0 +1,343 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/internal/iampolicy"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/spf13/cobra"
+)
+
+func iamCmd(clients ClientFactory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "iam",
+		Short: "Read the policies of roles, users and groups and check what they allow",
+		Long: `Read the policies of roles, users and groups and check what they allow.
+
+Principals are written role/NAME, user/NAME or group/NAME, or given as ARNs.
+The assumed-role ARNs quoted in AccessDenied messages name their role.`,
+	}
+
+	cmd.AddCommand(iamPoliciesCmd(clients))
+	cmd.AddCommand(iamCanCmd(clients))
+	return cmd
+}
+
+// iamPrincipal is a role, user or group. arn is empty until it is resolved.
+type iamPrincipal struct {
+	kind string
+	name string
+	arn  string
+}
+
+func (p iamPrincipal) String() string {
+	return p.kind + "/" + p.name
+}
+
+var principalKinds = []string{"role", "user", "group"}
+
+// parsePrincipal reads role/NAME, user/NAME, group/NAME, the ARN of one of
+// them, or an assumed-role session ARN, which stands for its role.
+func parsePrincipal(s string) (iamPrincipal, error) {
+	if strings.HasPrefix(s, "arn:") {
+		// arn:partition:service:region:account:resource
+		parts := strings.SplitN(s, ":", 6)
+		if len(parts) == 6 {
+			kind, rest, _ := strings.Cut(parts[5], "/")
+			switch {
+			case parts[2] == "sts" && kind == "assumed-role" && rest != "":
+				role, _, _ := strings.Cut(rest, "/")
+				return iamPrincipal{kind: "role", name: role}, nil
+			case parts[2] == "iam" && slices.Contains(principalKinds, kind) && rest != "":
+				// the name is the last part of the path
+				return iamPrincipal{kind: kind, name: rest[strings.LastIndex(rest, "/")+1:], arn: s}, nil
+			}
+		}
+		return iamPrincipal{}, clierr.New(clierr.KindInput, "%s is not the ARN of a role, user or group", s)
+	}
+	kind, name, _ := strings.Cut(s, "/")
+	if !slices.Contains(principalKinds, kind) || name == "" {
+		return iamPrincipal{}, clierr.New(clierr.KindInput, "Expected role/NAME, user/NAME, group/NAME or an ARN, got %q", s)
+	}
+	return iamPrincipal{kind: kind, name: name}, nil
+}
+
+// resolveARN looks up the ARN of a principal given by name.
+func (p *iamPrincipal) resolveARN(ctx context.Context, client IAMAPI) error {
+	if p.arn != "" {
+		return nil
+	}
+	var arn *string
+	var err error
+	switch p.kind {
+	case "role":
+		var out *iam.GetRoleOutput
+		if out, err = client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(p.name)}); err == nil {
+			arn = out.Role.Arn
+		}
+	case "user":
+		var out *iam.GetUserOutput
+		if out, err = client.GetUser(ctx, &iam.GetUserInput{UserName: aws.String(p.name)}); err == nil {
+			arn = out.User.Arn
+		}
+	case "group":
+		var out *iam.GetGroupOutput
+		if out, err = client.GetGroup(ctx, &iam.GetGroupInput{GroupName: aws.String(p.name)}); err == nil {
+			arn = out.Group.Arn
+		}
+	}
+	if err != nil {
+		return awsError(err, "Failed to look up %s", p)
+	}
+	p.arn = aws.ToString(arn)
+	return nil
+}
+
+type policyDocument struct {
+	Name string `json:"name"`
+	// Type is "managed" or "inline".
+	Type string `json:"type"`
+	Arn  string `json:"arn,omitempty"`
+	// Version is the default version of a managed policy.
+	Version      string                  `json:"version,omitempty"`
+	Document     json.RawMessage         `json:"document"`
+	Explanations []iampolicy.Explanation `json:"explanations,omitempty"`
+}
+
+var policyDocumentColumns = []printer.Column[policyDocument]{
+	{Header: "Name", Value: func(d policyDocument) string { return d.Name }},
+	{Header: "Type", Value: func(d policyDocument) string { return d.Type }},
+	{Header: "Version", Value: func(d policyDocument) string { return printer.Or(d.Version) }},
+	{Header: "ARN", Wide: true, Value: func(d policyDocument) string { return printer.Or(d.Arn) }},
+}
+
+func iamPoliciesCmd(clients ClientFactory) *cobra.Command {
+	var explain bool
+
+	cmd := &cobra.Command{
+		Use:   "policies <principal>",
+		Short: "Show the managed and inline policy documents of a role, user or group",
+		Long: `Show the policy documents of a role, user or group: the default version of
+every attached managed policy, then every inline policy. --explain summarizes
+each statement instead and flags wildcard principals, actions and resources.
+
+A user's policies do not include the ones it gets through its groups; look
+those up with group/NAME.`,
+		Example: `  devctl aws iam policies role/deploy
+  devctl aws iam policies user/alice --explain
+  devctl aws iam policies arn:aws:sts::111122223333:assumed-role/deploy/ci -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Principal is required")
+			}
+			principal, err := parsePrincipal(args[0])
+			if err != nil {
+				return err
+			}
+			client, err := clients.IAM(cmd.Context())
+			if err != nil {
+				return err
+			}
+			docs, err := principalPolicies(cmd.Context(), client, principal)
+			if err != nil {
+				return err
+			}
+			if explain {
+				for i := range docs {
+					policy, err := iampolicy.Parse(docs[i].Document)
+					if err != nil {
+						return clierr.Wrap(clierr.KindRemote, err, "Cannot explain %s", docs[i].Name)
+					}
+					docs[i].Explanations = iampolicy.Explain(policy)
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if output := printer.Output(cmd); !printer.IsTable(output) {
+				return printer.PrintAll(out, output, policyDocumentColumns, docs)
+			}
+			if len(docs) == 0 {
+				fmt.Fprintf(out, "%s has no policies.\n", principal)
+				return nil
+			}
+			for i, d := range docs {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				title := fmt.Sprintf("📜 %s policy %s", strings.ToUpper(d.Type[:1])+d.Type[1:], d.Name)
+				if d.Version != "" {
+					title += " (" + d.Version + ")"
+				}
+				fmt.Fprintln(out, title+":")
+				if explain {
+					printExplanations(out, d.Explanations)
+				} else {
+					printPolicy(out, string(d.Document))
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&explain, "explain", false, "Summarize each statement in plain language")
+	return cmd
+}
+
+// principalPolicies returns the documents of the managed policies attached
+// to p, then of its inline policies.
+func principalPolicies(ctx context.Context, client IAMAPI, p iamPrincipal) ([]policyDocument, error) {
+	attached, err := attachedPolicies(ctx, client, p)
+	if err != nil {
+		return nil, err
+	}
+	var docs []policyDocument
+	for _, a := range attached {
+		policy, err := client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: a.PolicyArn})
+		if err != nil {
+			return nil, awsError(err, "Failed to look up policy %s", aws.ToString(a.PolicyName))
+		}
+		version, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+			PolicyArn: a.PolicyArn,
+			VersionId: policy.Policy.DefaultVersionId,
+		})
+		if err != nil {
+			return nil, awsError(err, "Failed to get policy %s", aws.ToString(a.PolicyName))
+		}
+		docs = append(docs, policyDocument{
+			Name:     aws.ToString(a.PolicyName),
+			Type:     "managed",
+			Arn:      aws.ToString(a.PolicyArn),
+			Version:  aws.ToString(policy.Policy.DefaultVersionId),
+			Document: decodePolicy(aws.ToString(version.PolicyVersion.Document)),
+		})
+	}
+
+	names, err := inlinePolicyNames(ctx, client, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		document, err := inlinePolicy(ctx, client, p, name)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, policyDocument{Name: name, Type: "inline", Document: decodePolicy(document)})
+	}
+	return docs, nil
+}
+
+func attachedPolicies(ctx context.Context, client IAMAPI, p iamPrincipal) ([]iamtypes.AttachedPolicy, error) {
+	var attached []iamtypes.AttachedPolicy
+	switch p.kind {
+	case "role":
+		paginator := iam.NewListAttachedRolePoliciesPaginator(client, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(p.name)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, awsError(err, "Unable to list policies for %s", p)
+			}
+			attached = append(attached, page.AttachedPolicies...)
+		}
+	case "user":
+		paginator := iam.NewListAttachedUserPoliciesPaginator(client, &iam.ListAttachedUserPoliciesInput{UserName: aws.String(p.name)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, awsError(err, "Unable to list policies for %s", p)
+			}
+			attached = append(attached, page.AttachedPolicies...)
+		}
+	case "group":
+		paginator := iam.NewListAttachedGroupPoliciesPaginator(client, &iam.ListAttachedGroupPoliciesInput{GroupName: aws.String(p.name)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, awsError(err, "Unable to list policies for %s", p)
+			}
+			attached = append(attached, page.AttachedPolicies...)
+		}
+	}
+	return attached, nil
+}
+
+func inlinePolicyNames(ctx context.Context, client IAMAPI, p iamPrincipal) ([]string, error) {
+	var names []string
+	switch p.kind {
+	case "role":
+		paginator := iam.NewListRolePoliciesPaginator(client, &iam.ListRolePoliciesInput{RoleName: aws.String(p.name)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, awsError(err, "Unable to list inline policies for %s", p)
+			}
+			names = append(names, page.PolicyNames...)
+		}
+	case "user":
+		paginator := iam.NewListUserPoliciesPaginator(client, &iam.ListUserPoliciesInput{UserName: aws.String(p.name)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, awsError(err, "Unable to list inline policies for %s", p)
+			}
+			names = append(names, page.PolicyNames...)
+		}
+	case "group":
+		paginator := iam.NewListGroupPoliciesPaginator(client, &iam.ListGroupPoliciesInput{GroupName: aws.String(p.name)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, awsError(err, "Unable to list inline policies for %s", p)
+			}
+			names = append(names, page.PolicyNames...)
+		}
+	}
+	return names, nil
+}
+
+func inlinePolicy(ctx context.Context, client IAMAPI, p iamPrincipal, name string) (string, error) {
+	var document *string
+	var err error
+	switch p.kind {
+	case "role":
+		var out *iam.GetRolePolicyOutput
+		if out, err = client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{RoleName: aws.String(p.name), PolicyName: aws.String(name)}); err == nil {
+			document = out.PolicyDocument
+		}
+	case "user":
+		var out *iam.GetUserPolicyOutput
+		if out, err = client.GetUserPolicy(ctx, &iam.GetUserPolicyInput{UserName: aws.String(p.name), PolicyName: aws.String(name)}); err == nil {
+			document = out.PolicyDocument
+		}
+	case "group":
+		var out *iam.GetGroupPolicyOutput
+		if out, err = client.GetGroupPolicy(ctx, &iam.GetGroupPolicyInput{GroupName: aws.String(p.name), PolicyName: aws.String(name)}); err == nil {
+			document = out.PolicyDocument
+		}
+	}
+	if err != nil {
+		return "", awsError(err, "Failed to get inline policy %s of %s", name, p)
+	}
+	return aws.ToString(document), nil
+}
+
+// decodePolicy undoes the URL encoding IAM returns documents in. A document
+// that still isn't JSON is kept as a string so records stay printable.
+func decodePolicy(document string) json.RawMessage {
+	if decoded, err := url.PathUnescape(document); err == nil {
+		document = decoded
+	}
+	if !json.Valid([]byte(document)) {
+		quoted, _ := json.Marshal(document)
+		return quoted
+	}
+	return json.RawMessage(document)
+}
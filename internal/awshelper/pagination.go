@@ -0,0 +1,132 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+)
+
+// pageFlags holds the pagination flags shared by the list commands.
+type pageFlags struct {
+	maxItems      int32
+	pageSize      int32
+	startingToken string
+}
+
+// register adds the pagination flags to cmd. Not every API accepts a page
+// size, so --page-size is optional.
+func (f *pageFlags) register(cmd *cobra.Command, withPageSize bool) {
+	cmd.Flags().Int32Var(&f.maxItems, "max-items", 0, "Maximum number of items to return (0 returns everything)")
+	cmd.Flags().StringVar(&f.startingToken, "starting-token", "", "Resume from the NextToken printed by an earlier call")
+	if withPageSize {
+		cmd.Flags().Int32Var(&f.pageSize, "page-size", 0, "Number of items to request per API call (default: service maximum)")
+	}
+}
+
+// limit returns the page size to request, between the smallest and largest
+// the API accepts, so that small --max-items values do not fetch a full page.
+// When smallest is still more than --max-items, paginate trims the page. Zero leaves the
+// service default.
+func (f *pageFlags) limit(smallest, largest int32) int32 {
+	if f.pageSize <= 0 && f.maxItems <= 0 {
+		return 0
+	}
+	size := f.pageSize
+	if size <= 0 || size > largest {
+		size = largest
+	}
+	if f.maxItems > 0 && f.maxItems < size {
+		size = f.maxItems
+	}
+	return max(size, smallest)
+}
+
+// resumeToken lets --starting-token continue in the middle of a page: it
+// holds the API token of the page and how many of its items were printed.
+type resumeToken struct {
+	Token string `json:"t,omitempty"`
+	Skip  int    `json:"s,omitempty"`
+}
+
+func (t resumeToken) String() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// pageStart is where a listing begins: the API token of the first page and
+// the number of its items already printed by an earlier call.
+type pageStart struct {
+	token *string
+	skip  int
+}
+
+// start decodes --starting-token.
+func (f *pageFlags) start() (pageStart, error) {
+	if f.startingToken == "" {
+		return pageStart{}, nil
+	}
+	var t resumeToken
+	data, err := base64.RawURLEncoding.DecodeString(f.startingToken)
+	if err == nil {
+		err = json.Unmarshal(data, &t)
+	}
+	if err != nil {
+		return pageStart{}, clierr.New(clierr.KindInput, "Invalid --starting-token %q", f.startingToken)
+	}
+	start := pageStart{skip: t.Skip}
+	if t.Token != "" {
+		start.token = aws.String(t.Token)
+	}
+	return start, nil
+}
+
+// paginate drives an SDK paginator created from start: next fetches one page
+// and returns its items and the API token of the following page. Items are
+// handed to emit as each page arrives and flush is called after every page.
+// When --max-items cuts the listing short, the token to resume from is
+// written to stderr.
+func paginate[T any](ctx context.Context, cmd *cobra.Command, f *pageFlags, start pageStart, hasMore func() bool,
+	next func(context.Context) ([]T, *string, error), emit func(T) error, flush func() error) error {
+	pageToken, skip := start.token, start.skip
+
+	var emitted int32
+	for hasMore() {
+		if f.maxItems > 0 && emitted >= f.maxItems {
+			return printNextToken(cmd.ErrOrStderr(), resumeToken{Token: aws.ToString(pageToken)})
+		}
+
+		items, nextToken, err := next(ctx)
+		if err != nil {
+			return err
+		}
+		for i := skip; i < len(items); i++ {
+			if f.maxItems > 0 && emitted >= f.maxItems {
+				if err := flush(); err != nil {
+					return err
+				}
+				return printNextToken(cmd.ErrOrStderr(), resumeToken{Token: aws.ToString(pageToken), Skip: i})
+			}
+			if err := emit(items[i]); err != nil {
+				return err
+			}
+			emitted++
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		skip = 0
+		pageToken = nextToken
+	}
+	return nil
+}
+
+func printNextToken(w io.Writer, t resumeToken) error {
+	_, err := fmt.Fprintf(w, "NextToken: %s\n", t)
+	return err
+}
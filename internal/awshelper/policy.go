@@ -0,0 +1,66 @@
+package awshelper
+
+import (
+	"bytes"
+	"devctl/internal/iampolicy"
+	"devctl/pkg/clierr"
+	"devctl/pkg/color"
+	"devctl/pkg/printer"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var explanationColumns = []printer.Column[iampolicy.Explanation]{
+	{Header: "#", Value: func(e iampolicy.Explanation) string { return strconv.Itoa(e.Statement) }},
+	{Header: "Sid", Value: func(e iampolicy.Explanation) string { return printer.Or(e.Sid) }},
+	{Header: "Effect", Value: func(e iampolicy.Explanation) string { return e.Effect }},
+	{Header: "Summary", Value: func(e iampolicy.Explanation) string { return e.Summary }},
+	{Header: "Warnings", Value: func(e iampolicy.Explanation) string { return printer.Or(strings.Join(e.Warnings, "; ")) }},
+}
+
+// printPolicy writes a policy document indented and, on a terminal,
+// highlighted. Documents that aren't valid JSON are written as they are.
+func printPolicy(out io.Writer, document string) {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(document), "", "  "); err != nil {
+		fmt.Fprintln(out, document)
+		return
+	}
+	fmt.Fprintln(out, color.For(out).JSON(indented.String()))
+}
+
+// explainPolicy prints a plain-language summary of every statement: as
+// numbered paragraphs with their warnings for tables, as records otherwise.
+func explainPolicy(cmd *cobra.Command, document string) error {
+	policy, err := iampolicy.Parse([]byte(document))
+	if err != nil {
+		return clierr.Wrap(clierr.KindRemote, err, "Cannot explain the policy")
+	}
+	explanations := iampolicy.Explain(policy)
+
+	out := cmd.OutOrStdout()
+	if output := printer.Output(cmd); !printer.IsTable(output) {
+		return printer.PrintAll(out, output, explanationColumns, explanations)
+	}
+	printExplanations(out, explanations)
+	return nil
+}
+
+func printExplanations(out io.Writer, explanations []iampolicy.Explanation) {
+	paint := color.For(out)
+	for _, e := range explanations {
+		title := fmt.Sprintf("Statement %d", e.Statement)
+		if e.Sid != "" {
+			title += " (" + e.Sid + ")"
+		}
+		fmt.Fprintf(out, "%s: %s\n", paint.Bold(title), e.Summary)
+		for _, w := range e.Warnings {
+			fmt.Fprintf(out, "  %s\n", paint.Yellow("⚠️ "+w))
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"devctl/pkg/utils"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/cobra"
+)
+
+type bucketRecord struct {
+	origin
+	Name         string     `json:"name"`
+	CreationDate *time.Time `json:"creationDate,omitempty"`
+}
+
+var bucketColumns = []printer.Column[bucketRecord]{
+	{Header: "Name", Value: func(b bucketRecord) string { return b.Name }},
+	{Header: "Created", Value: func(b bucketRecord) string { return printer.Time(b.CreationDate) }},
+}
+
+func listS3Cmd(clients ClientFactory) *cobra.Command {
+	var pages pageFlags
+	var fan fanoutFlags
+
+	cmd := &cobra.Command{
+		Use:   "list-s3",
+		Short: "List all S3 buckets",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// ListBuckets is global: fan out over accounts only and take the
+			// region from each bucket
+			return runList(cmd, clients, &pages, &fan, false, bucketColumns,
+				func(ctx context.Context, t target, start pageStart, emit func(bucketRecord) error, flush func() error) error {
+					client, err := t.clients.S3(ctx)
+					if err != nil {
+						return err
+					}
+
+					paginator := s3.NewListBucketsPaginator(client, &s3.ListBucketsInput{ContinuationToken: start.token},
+						func(o *s3.ListBucketsPaginatorOptions) { o.Limit = pages.limit(1, 10000) })
+					return paginate(ctx, cmd, &pages, start, paginator.HasMorePages,
+						func(ctx context.Context) ([]s3types.Bucket, *string, error) {
+							page, err := paginator.NextPage(ctx)
+							if err != nil {
+								return nil, nil, awsError(err, "Unable to list buckets")
+							}
+							return page.Buckets, page.ContinuationToken, nil
+						},
+						func(bucket s3types.Bucket) error {
+							return emit(bucketRecord{
+								origin:       origin{Account: t.Account, Region: aws.ToString(bucket.BucketRegion)},
+								Name:         aws.ToString(bucket.Name),
+								CreationDate: bucket.CreationDate,
+							})
+						}, flush)
+				})
+		},
+	}
+
+	pages.register(cmd, true)
+	fan.register(cmd)
+	return cmd
+}
+
+type objectRecord struct {
+	Key          string     `json:"key"`
+	Size         int64      `json:"size"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	StorageClass string     `json:"storageClass,omitempty"`
+	// Prefix marks a common prefix, shown as a folder in delimited listings.
+	Prefix bool `json:"prefix,omitempty"`
+}
+
+var objectColumns = []printer.Column[objectRecord]{
+	{Header: "Key", Value: func(o objectRecord) string { return o.Key }},
+	{Header: "Size", Value: func(o objectRecord) string {
+		if o.Prefix {
+			return "PRE"
+		}
+		return utils.HumanSize(o.Size)
+	}},
+	{Header: "Last Modified", Value: func(o objectRecord) string { return printer.Time(o.LastModified) }},
+	{Header: "Storage Class", Value: func(o objectRecord) string { return printer.Or(o.StorageClass) }},
+	{Header: "Bytes", Wide: true, Value: func(o objectRecord) string { return strconv.FormatInt(o.Size, 10) }},
+}
+
+func newObjectRecord(object s3types.Object) objectRecord {
+	return objectRecord{
+		Key:          aws.ToString(object.Key),
+		Size:         aws.ToInt64(object.Size),
+		LastModified: object.LastModified,
+		StorageClass: string(object.StorageClass),
+	}
+}
+
+// list the objects in the bucket
+func listBucketObjectsCmd(clients ClientFactory) *cobra.Command {
+	var pages pageFlags
+	var prefix, delimiter string
+	var recursive, du bool
+	var concurrency int
+
+	cmd := &cobra.Command{
+		Use:   "list-bucket-objects <bucket>",
+		Short: "List objects in an S3 bucket",
+		Long: `List the objects and folders directly under --prefix, like ls. Folders are the
+key prefixes up to the next --delimiter; --recursive lists every object under
+the prefix instead.
+
+--du sums the size and object count of every folder under --prefix, listing
+the folders concurrently, and shows the largest first.`,
+		Example: `  devctl aws list-bucket-objects prod-assets --prefix images/
+  devctl aws list-bucket-objects prod-logs --prefix 2024/ --recursive -o json
+  devctl aws list-bucket-objects prod-logs --du`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Bucket name is required")
+			}
+			bucketName := args[0]
+			if delimiter == "" {
+				return clierr.New(clierr.KindInput, "--delimiter can't be empty; use --recursive to list without folders")
+			}
+
+			if du {
+				if pages.maxItems > 0 || pages.startingToken != "" {
+					return clierr.New(clierr.KindInput, "--du can't be combined with --max-items or --starting-token")
+				}
+				if concurrency < 1 {
+					return clierr.New(clierr.KindInput, "--concurrency must be at least 1")
+				}
+				client, err := clients.S3(cmd.Context())
+				if err != nil {
+					return err
+				}
+				return printDiskUsage(cmd, client, s3Location{Bucket: bucketName, Key: prefix}, delimiter, concurrency)
+			}
+
+			start, err := pages.start()
+			if err != nil {
+				return err
+			}
+			p, err := printer.New(cmd.OutOrStdout(), printer.Output(cmd), objectColumns)
+			if err != nil {
+				return err
+			}
+			client, err := clients.S3(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			input := &s3.ListObjectsV2Input{
+				Bucket:            aws.String(bucketName),
+				ContinuationToken: start.token,
+			}
+			if prefix != "" {
+				input.Prefix = aws.String(prefix)
+			}
+			if !recursive {
+				input.Delimiter = aws.String(delimiter)
+			}
+			paginator := s3.NewListObjectsV2Paginator(client, input,
+				func(o *s3.ListObjectsV2PaginatorOptions) { o.Limit = pages.limit(1, 1000) })
+			err = paginate(cmd.Context(), cmd, &pages, start, paginator.HasMorePages,
+				func(ctx context.Context) ([]objectRecord, *string, error) {
+					page, err := paginator.NextPage(ctx)
+					if err != nil {
+						return nil, nil, awsError(err, "Unable to list objects")
+					}
+					records := make([]objectRecord, 0, len(page.CommonPrefixes)+len(page.Contents))
+					for _, cp := range page.CommonPrefixes {
+						records = append(records, objectRecord{Key: aws.ToString(cp.Prefix), Prefix: true})
+					}
+					for _, object := range page.Contents {
+						records = append(records, newObjectRecord(object))
+					}
+					// S3 returns folders and objects in key order, but separately
+					sort.SliceStable(records, func(i, j int) bool { return records[i].Key < records[j].Key })
+					return records, page.NextContinuationToken, nil
+				},
+				p.Print, p.Sync)
+			if err != nil {
+				return err
+			}
+			return p.Flush()
+		},
+	}
+
+	pages.register(cmd, true)
+	cmd.Flags().StringVar(&prefix, "prefix", "", "Only list keys starting with this prefix, e.g. logs/2024/")
+	cmd.Flags().StringVar(&delimiter, "delimiter", "/", "Character that separates folders in keys")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "List every object under the prefix instead of one folder level")
+	cmd.Flags().BoolVar(&du, "du", false, "Sum the size and object count of each folder under the prefix")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 8, "Folders summed in parallel with --du")
+	return cmd
+}
+
+type usageRecord struct {
+	Prefix  string `json:"prefix"`
+	Objects int64  `json:"objects"`
+	Size    int64  `json:"size"`
+}
+
+var usageColumns = []printer.Column[usageRecord]{
+	{Header: "Prefix", Value: func(u usageRecord) string { return printer.Or(u.Prefix) }},
+	{Header: "Objects", Value: func(u usageRecord) string { return strconv.FormatInt(u.Objects, 10) }},
+	{Header: "Size", Value: func(u usageRecord) string { return utils.HumanSize(u.Size) }},
+	{Header: "Bytes", Wide: true, Value: func(u usageRecord) string { return strconv.FormatInt(u.Size, 10) }},
+}
+
+// printDiskUsage prints the size of every folder directly under loc, summed
+// with at most concurrency folders listed at once. Objects directly under
+// loc are counted on a row of their own, named after loc.
+func printDiskUsage(cmd *cobra.Command, client S3API, loc s3Location, delimiter string, concurrency int) error {
+	ctx := cmd.Context()
+
+	top := usageRecord{Prefix: loc.Key}
+	var folders []string
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(loc.Bucket),
+		Prefix:    aws.String(loc.Key),
+		Delimiter: aws.String(delimiter),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return awsError(err, "Unable to list objects under %s", loc)
+		}
+		for _, cp := range page.CommonPrefixes {
+			folders = append(folders, aws.ToString(cp.Prefix))
+		}
+		for _, object := range page.Contents {
+			top.Objects++
+			top.Size += aws.ToInt64(object.Size)
+		}
+	}
+
+	usage := make([]usageRecord, len(folders))
+	errs := make([]error, len(folders))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, folder := range folders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			usage[i].Prefix = folder
+			objects, err := listObjects(ctx, client, s3Location{Bucket: loc.Bucket, Key: folder})
+			for _, object := range objects {
+				usage[i].Objects++
+				usage[i].Size += aws.ToInt64(object.Size)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	if top.Objects > 0 {
+		usage = append(usage, top)
+	}
+	sort.SliceStable(usage, func(i, j int) bool { return usage[i].Size > usage[j].Size })
+
+	output := printer.Output(cmd)
+	if err := printer.PrintAll(cmd.OutOrStdout(), output, usageColumns, usage); err != nil {
+		return err
+	}
+	if printer.IsTable(output) {
+		total := usageRecord{}
+		for _, u := range usage {
+			total.Objects += u.Objects
+			total.Size += u.Size
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "\nTotal: %d objects, %s in %s\n", total.Objects, utils.HumanSize(total.Size), loc)
+	}
+	return nil
+}
+
+// display bucket policies of a bucket
+func displayBucketPolicyCmd(clients ClientFactory) *cobra.Command {
+	var explain bool
+
+	cmd := &cobra.Command{
+		Use:   "display-bucket-policy",
+		Short: "Display S3 bucket policy",
+		Long: `Display a bucket's policy, indented and highlighted on a terminal.
+
+With --explain each statement is summarized instead: who can or cannot do
+what on which resources under which conditions, with warnings for wildcard
+principals, actions and resources in Allow statements.`,
+		Example: `  devctl aws display-bucket-policy prod-assets
+  devctl aws display-bucket-policy prod-assets --explain`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Bucket name is required")
+			}
+			bucketName := args[0]
+
+			client, err := clients.S3(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			result, err := client.GetBucketPolicy(cmd.Context(), &s3.GetBucketPolicyInput{
+				Bucket: aws.String(bucketName),
+			})
+			if err != nil {
+				return awsError(err, "Unable to get bucket policy")
+			}
+
+			if explain {
+				return explainPolicy(cmd, aws.ToString(result.Policy))
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "🪣 Bucket Policy for %s:\n", bucketName)
+			printPolicy(cmd.OutOrStdout(), aws.ToString(result.Policy))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&explain, "explain", false, "Summarize each statement in plain language and flag wildcards")
+	return cmd
+}
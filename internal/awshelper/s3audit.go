@@ -0,0 +1,382 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/internal/iampolicy"
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	auditPass = "pass"
+	auditWarn = "warn"
+	auditFail = "fail"
+)
+
+// ACL groups that make a grant public.
+const (
+	allUsersGroup           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	authenticatedUsersGroup = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+type auditResult struct {
+	Bucket string `json:"bucket"`
+	Check  string `json:"check"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+var auditColumns = []printer.Column[auditResult]{
+	{Header: "Bucket", Value: func(r auditResult) string { return r.Bucket }},
+	{Header: "Check", Value: func(r auditResult) string { return r.Check }},
+	{Header: "Status", Value: func(r auditResult) string { return r.Status }},
+	{Header: "Detail", Value: func(r auditResult) string { return r.Detail }},
+}
+
+// bucketCheck inspects one part of a bucket's configuration and returns a
+// status and a one-line explanation.
+type bucketCheck struct {
+	name string
+	run  func(ctx context.Context, client S3API, bucket string) (status, detail string, err error)
+}
+
+var bucketChecks = []bucketCheck{
+	{name: "public-access-block", run: checkPublicAccessBlock},
+	{name: "policy", run: checkBucketPolicy},
+	{name: "acl", run: checkBucketACL},
+	{name: "encryption", run: checkBucketEncryption},
+	{name: "versioning", run: checkBucketVersioning},
+	{name: "logging", run: checkBucketLogging},
+	{name: "lifecycle", run: checkBucketLifecycle},
+}
+
+func s3AuditCmd(clients ClientFactory) *cobra.Command {
+	var concurrency int
+
+	cmd := &cobra.Command{
+		Use:   "audit [bucket...]",
+		Short: "Check buckets for public access, encryption, versioning, logging and lifecycle rules",
+		Long: `Check the given buckets, or every bucket in the account, and report pass,
+warn or fail for each check:
+
+  public-access-block  all four Block Public Access settings are on
+  policy               no Allow statement has a "*" principal (warn when it is conditional)
+  acl                  no grant to AllUsers or AuthenticatedUsers
+  encryption           default encryption is configured
+  versioning           versioning is enabled
+  logging              server access logging is on
+  lifecycle            at least one lifecycle rule is enabled
+
+Checks that can't be read, e.g. for lack of permission, are reported as warn.
+The account-wide Block Public Access settings are not taken into account.
+
+Use -o json or -o yaml for a machine-readable report. Exits with code 7 when
+any check fails.`,
+		Example: `  devctl aws s3 audit
+  devctl aws s3 audit prod-assets prod-logs -o json > s3-audit.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if concurrency < 1 {
+				return clierr.New(clierr.KindInput, "--concurrency must be at least 1")
+			}
+			ctx := cmd.Context()
+
+			p, err := printer.New(cmd.OutOrStdout(), printer.Output(cmd), auditColumns)
+			if err != nil {
+				return err
+			}
+			client, err := clients.S3(ctx)
+			if err != nil {
+				return err
+			}
+
+			buckets := args
+			regions := map[string]string{}
+			if len(buckets) == 0 {
+				paginator := s3.NewListBucketsPaginator(client, &s3.ListBucketsInput{})
+				for paginator.HasMorePages() {
+					page, err := paginator.NextPage(ctx)
+					if err != nil {
+						return awsError(err, "Unable to list buckets")
+					}
+					for _, b := range page.Buckets {
+						buckets = append(buckets, aws.ToString(b.Name))
+						regions[aws.ToString(b.Name)] = aws.ToString(b.BucketRegion)
+					}
+				}
+			}
+			if len(buckets) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "✅ No buckets to audit.")
+				return nil
+			}
+
+			results := make([][]auditResult, len(buckets))
+			var wg sync.WaitGroup
+			sem := make(chan struct{}, concurrency)
+			for i, bucket := range buckets {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sem <- struct{}{}
+					defer func() { <-sem }()
+					results[i] = auditBucket(ctx, clients, client, bucket, regions[bucket])
+				}()
+			}
+			wg.Wait()
+
+			counts := map[string]int{}
+			var failed int
+			for _, bucketResults := range results {
+				bucketFailed := false
+				for _, r := range bucketResults {
+					counts[r.Status]++
+					bucketFailed = bucketFailed || r.Status == auditFail
+					if err := p.Print(r); err != nil {
+						return err
+					}
+				}
+				if bucketFailed {
+					failed++
+				}
+			}
+			if err := p.Flush(); err != nil {
+				return err
+			}
+			if printer.IsTable(printer.Output(cmd)) {
+				fmt.Fprintf(cmd.OutOrStdout(), "\n%d buckets: %d pass, %d warn, %d fail\n",
+					len(buckets), counts[auditPass], counts[auditWarn], counts[auditFail])
+			}
+
+			if failed > 0 {
+				return clierr.New(clierr.KindCheckFailed, "%d of %d buckets failed the audit", failed, len(buckets))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&concurrency, "concurrency", 8, "Buckets audited in parallel")
+	return cmd
+}
+
+// auditBucket runs every check against bucket with a client for the
+// bucket's region, looking the region up when it isn't known.
+func auditBucket(ctx context.Context, clients ClientFactory, client S3API, bucket, region string) []auditResult {
+	unreadable := func(err error) []auditResult {
+		return []auditResult{{Bucket: bucket, Check: "bucket", Status: auditFail, Detail: "Could not read the bucket: " + errorSummary(err)}}
+	}
+	if region == "" {
+		var err error
+		if region, err = bucketRegion(ctx, client, bucket); err != nil {
+			return unreadable(err)
+		}
+	}
+	regional, err := clients.ForRegion(region).S3(ctx)
+	if err != nil {
+		return unreadable(err)
+	}
+
+	var results []auditResult
+	for _, check := range bucketChecks {
+		status, detail, err := check.run(ctx, regional, bucket)
+		if err != nil {
+			status, detail = auditWarn, "Could not check: "+errorSummary(err)
+		}
+		results = append(results, auditResult{Bucket: bucket, Check: check.name, Status: status, Detail: detail})
+	}
+	return results
+}
+
+// bucketRegion returns the region of bucket. GetBucketLocation reports
+// us-east-1 as no constraint and eu-west-1 by its legacy name.
+func bucketRegion(ctx context.Context, client S3API, bucket string) (string, error) {
+	out, err := client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", err
+	}
+	switch out.LocationConstraint {
+	case "":
+		return "us-east-1", nil
+	case s3types.BucketLocationConstraintEu:
+		return "eu-west-1", nil
+	}
+	return string(out.LocationConstraint), nil
+}
+
+// errorSummary is the AWS error code of err, which fits in a report column
+// where the full SDK message does not.
+func errorSummary(err error) string {
+	if code := errorCode(err); code != "" {
+		return code
+	}
+	return err.Error()
+}
+
+func checkPublicAccessBlock(ctx context.Context, client S3API, bucket string) (string, string, error) {
+	out, err := client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{Bucket: aws.String(bucket)})
+	if errorCode(err) == "NoSuchPublicAccessBlockConfiguration" {
+		return auditFail, "Block Public Access is not configured", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	c := out.PublicAccessBlockConfiguration
+	settings := []struct {
+		name string
+		on   *bool
+	}{
+		{"BlockPublicAcls", c.BlockPublicAcls},
+		{"IgnorePublicAcls", c.IgnorePublicAcls},
+		{"BlockPublicPolicy", c.BlockPublicPolicy},
+		{"RestrictPublicBuckets", c.RestrictPublicBuckets},
+	}
+	var off []string
+	for _, s := range settings {
+		if !aws.ToBool(s.on) {
+			off = append(off, s.name)
+		}
+	}
+	switch len(off) {
+	case 0:
+		return auditPass, "All settings are on", nil
+	case len(settings):
+		return auditFail, "All settings are off", nil
+	}
+	return auditWarn, "Off: " + strings.Join(off, ", "), nil
+}
+
+func checkBucketPolicy(ctx context.Context, client S3API, bucket string) (string, string, error) {
+	out, err := client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+	if errorCode(err) == "NoSuchBucketPolicy" {
+		return auditPass, "No bucket policy", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	policy, err := iampolicy.Parse([]byte(aws.ToString(out.Policy)))
+	if err != nil {
+		return "", "", err
+	}
+
+	var public, conditional []string
+	for i, s := range policy.Statement {
+		if !s.Allows() || !s.Public() {
+			continue
+		}
+		name := s.Sid
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if s.Conditional() {
+			conditional = append(conditional, name)
+		} else {
+			public = append(public, name)
+		}
+	}
+	switch {
+	case len(public) > 0:
+		return auditFail, "Allows any principal: " + strings.Join(public, ", "), nil
+	case len(conditional) > 0:
+		return auditWarn, "Allows any principal under conditions: " + strings.Join(conditional, ", "), nil
+	}
+	return auditPass, "No statement allows any principal", nil
+}
+
+func checkBucketACL(ctx context.Context, client S3API, bucket string) (string, string, error) {
+	out, err := client.GetBucketAcl(ctx, &s3.GetBucketAclInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", "", err
+	}
+
+	var public []string
+	for _, g := range out.Grants {
+		if g.Grantee == nil || g.Grantee.Type != s3types.TypeGroup {
+			continue
+		}
+		switch uri := aws.ToString(g.Grantee.URI); uri {
+		case allUsersGroup, authenticatedUsersGroup:
+			public = append(public, fmt.Sprintf("%s %s", uri[strings.LastIndex(uri, "/")+1:], g.Permission))
+		}
+	}
+	if len(public) > 0 {
+		return auditFail, "Grants " + strings.Join(public, ", "), nil
+	}
+	return auditPass, "No public grants", nil
+}
+
+func checkBucketEncryption(ctx context.Context, client S3API, bucket string) (string, string, error) {
+	out, err := client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	if errorCode(err) == "ServerSideEncryptionConfigurationNotFoundError" {
+		return auditFail, "No default encryption", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, rule := range out.ServerSideEncryptionConfiguration.Rules {
+		if byDefault := rule.ApplyServerSideEncryptionByDefault; byDefault != nil {
+			detail := string(byDefault.SSEAlgorithm)
+			if key := aws.ToString(byDefault.KMSMasterKeyID); key != "" {
+				detail += " with " + key
+			}
+			return auditPass, detail, nil
+		}
+	}
+	return auditFail, "No default encryption", nil
+}
+
+func checkBucketVersioning(ctx context.Context, client S3API, bucket string) (string, string, error) {
+	out, err := client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", "", err
+	}
+	switch out.Status {
+	case s3types.BucketVersioningStatusEnabled:
+		if out.MFADelete == s3types.MFADeleteStatusEnabled {
+			return auditPass, "Enabled, with MFA delete", nil
+		}
+		return auditPass, "Enabled", nil
+	case s3types.BucketVersioningStatusSuspended:
+		return auditWarn, "Suspended", nil
+	}
+	return auditWarn, "Never enabled", nil
+}
+
+func checkBucketLogging(ctx context.Context, client S3API, bucket string) (string, string, error) {
+	out, err := client.GetBucketLogging(ctx, &s3.GetBucketLoggingInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", "", err
+	}
+	if out.LoggingEnabled == nil {
+		return auditWarn, "Server access logging is off", nil
+	}
+	return auditPass, fmt.Sprintf("To s3://%s/%s", aws.ToString(out.LoggingEnabled.TargetBucket), aws.ToString(out.LoggingEnabled.TargetPrefix)), nil
+}
+
+func checkBucketLifecycle(ctx context.Context, client S3API, bucket string) (string, string, error) {
+	out, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket)})
+	if errorCode(err) == "NoSuchLifecycleConfiguration" {
+		return auditWarn, "No lifecycle rules", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	var enabled int
+	for _, rule := range out.Rules {
+		if rule.Status == s3types.ExpirationStatusEnabled {
+			enabled++
+		}
+	}
+	if enabled == 0 {
+		return auditWarn, fmt.Sprintf("All %d lifecycle rules are disabled", len(out.Rules)), nil
+	}
+	return auditPass, fmt.Sprintf("%d of %d rules enabled", enabled, len(out.Rules)), nil
+}
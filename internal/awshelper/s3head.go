@@ -0,0 +1,176 @@
+package awshelper
+
+import (
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/cobra"
+)
+
+type objectLock struct {
+	Mode        string     `json:"mode,omitempty"`
+	RetainUntil *time.Time `json:"retainUntil,omitempty"`
+	LegalHold   string     `json:"legalHold,omitempty"`
+}
+
+type objectDetail struct {
+	Bucket       string            `json:"bucket"`
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	ContentType  string            `json:"contentType,omitempty"`
+	ETag         string            `json:"etag,omitempty"`
+	LastModified *time.Time        `json:"lastModified,omitempty"`
+	StorageClass string            `json:"storageClass"`
+	Encryption   string            `json:"encryption,omitempty"`
+	KMSKeyID     string            `json:"kmsKeyId,omitempty"`
+	VersionID    string            `json:"versionId,omitempty"`
+	ObjectLock   *objectLock       `json:"objectLock,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+var objectDetailColumns = []printer.Column[objectDetail]{
+	{Header: "Key", Value: func(o objectDetail) string { return o.Key }},
+	{Header: "Size", Value: func(o objectDetail) string { return strconv.FormatInt(o.Size, 10) }},
+	{Header: "Storage Class", Value: func(o objectDetail) string { return o.StorageClass }},
+	{Header: "Encryption", Value: func(o objectDetail) string { return printer.Or(o.Encryption) }},
+	{Header: "Version ID", Value: func(o objectDetail) string { return printer.Or(o.VersionID) }},
+}
+
+func s3HeadCmd(clients ClientFactory) *cobra.Command {
+	var versionID string
+
+	cmd := &cobra.Command{
+		Use:   "head <bucket>/<key>",
+		Short: "Show an object's size, storage class, encryption, lock, tags and metadata",
+		Example: `  devctl aws s3 head builds/app/1.4.2.tar.gz
+  devctl aws s3 head s3://audit/2024/q1.csv --version-id 3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Object location is required")
+			}
+			loc, err := objectArg(args[0])
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+
+			client, err := clients.S3(ctx)
+			if err != nil {
+				return err
+			}
+			var version *string
+			if versionID != "" {
+				version = aws.String(versionID)
+			}
+			head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+				Bucket:    aws.String(loc.Bucket),
+				Key:       aws.String(loc.Key),
+				VersionId: version,
+			})
+			if err != nil {
+				return awsError(err, "Failed to look up %s", loc)
+			}
+			detail := newObjectDetail(loc, head)
+
+			// tags need their own permission; without it the rest still helps
+			tagging, err := client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+				Bucket:    aws.String(loc.Bucket),
+				Key:       aws.String(loc.Key),
+				VersionId: version,
+			})
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "⚠️ %v\n", awsError(err, "Failed to get the tags of %s", loc))
+			} else if len(tagging.TagSet) > 0 {
+				detail.Tags = map[string]string{}
+				for _, tag := range tagging.TagSet {
+					detail.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+			}
+
+			if output := printer.Output(cmd); !printer.IsTable(output) {
+				return printer.PrintAll(cmd.OutOrStdout(), output, objectDetailColumns, []objectDetail{detail})
+			}
+			return printObjectDetail(cmd.OutOrStdout(), detail)
+		},
+	}
+
+	cmd.Flags().StringVar(&versionID, "version-id", "", "Show this version instead of the current one")
+	return cmd
+}
+
+func newObjectDetail(loc s3Location, head *s3.HeadObjectOutput) objectDetail {
+	d := objectDetail{
+		Bucket:       loc.Bucket,
+		Key:          loc.Key,
+		Size:         aws.ToInt64(head.ContentLength),
+		ContentType:  aws.ToString(head.ContentType),
+		ETag:         strings.Trim(aws.ToString(head.ETag), `"`),
+		LastModified: head.LastModified,
+		// S3 leaves the header out for the default class
+		StorageClass: string(s3types.StorageClassStandard),
+		Encryption:   string(head.ServerSideEncryption),
+		KMSKeyID:     aws.ToString(head.SSEKMSKeyId),
+		VersionID:    aws.ToString(head.VersionId),
+		Metadata:     head.Metadata,
+	}
+	if head.StorageClass != "" {
+		d.StorageClass = string(head.StorageClass)
+	}
+	if head.ObjectLockMode != "" || head.ObjectLockLegalHoldStatus != "" {
+		d.ObjectLock = &objectLock{
+			Mode:        string(head.ObjectLockMode),
+			RetainUntil: head.ObjectLockRetainUntilDate,
+			LegalHold:   string(head.ObjectLockLegalHoldStatus),
+		}
+	}
+	if len(d.Metadata) == 0 {
+		d.Metadata = nil
+	}
+	return d
+}
+
+func printObjectDetail(out io.Writer, d objectDetail) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Object:\ts3://%s/%s\n", d.Bucket, d.Key)
+	fmt.Fprintf(w, "Size:\t%d bytes\n", d.Size)
+	fmt.Fprintf(w, "Content type:\t%s\n", printer.Or(d.ContentType))
+	fmt.Fprintf(w, "ETag:\t%s\n", printer.Or(d.ETag))
+	fmt.Fprintf(w, "Last modified:\t%s\n", printer.Time(d.LastModified))
+	fmt.Fprintf(w, "Storage class:\t%s\n", d.StorageClass)
+	encryption := printer.Or(d.Encryption)
+	if d.KMSKeyID != "" {
+		encryption += " (" + d.KMSKeyID + ")"
+	}
+	fmt.Fprintf(w, "Encryption:\t%s\n", encryption)
+	fmt.Fprintf(w, "Version ID:\t%s\n", printer.Or(d.VersionID))
+	if d.ObjectLock != nil {
+		fmt.Fprintf(w, "Object lock:\t%s until %s, legal hold %s\n",
+			printer.Or(d.ObjectLock.Mode), printer.Time(d.ObjectLock.RetainUntil), printer.Or(d.ObjectLock.LegalHold))
+	} else {
+		fmt.Fprintf(w, "Object lock:\t-\n")
+	}
+
+	if len(d.Tags) > 0 {
+		fmt.Fprintln(w, "\nTags:")
+		for _, k := range sortedKeys(d.Tags) {
+			fmt.Fprintf(w, "  %s\t%s\n", k, d.Tags[k])
+		}
+	}
+	if len(d.Metadata) > 0 {
+		fmt.Fprintln(w, "\nMetadata:")
+		for _, k := range sortedKeys(d.Metadata) {
+			fmt.Fprintf(w, "  %s\t%s\n", k, d.Metadata[k])
+		}
+	}
+	return w.Flush()
+}
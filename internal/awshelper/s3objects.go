@@ -0,0 +1,757 @@
+package awshelper
+
+import (
+	"context"
+	"crypto/md5"
+	"devctl/pkg/clierr"
+	"devctl/pkg/prompt"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/cobra"
+)
+
+// maxCopySize is the largest object CopyObject copies in a single request.
+const maxCopySize = 5 << 30
+
+// maxDeleteBatch is the most keys DeleteObjects accepts per request.
+const maxDeleteBatch = 1000
+
+// maxListed caps the keys printed before rm asks for confirmation.
+const maxListed = 20
+
+// s3Location is an s3://bucket/key argument; Key may be empty or a prefix.
+type s3Location struct {
+	Bucket string
+	Key    string
+}
+
+func (l s3Location) String() string {
+	return "s3://" + l.Bucket + "/" + l.Key
+}
+
+// child returns the location of name below l, a prefix.
+func (l s3Location) child(name string) s3Location {
+	return s3Location{Bucket: l.Bucket, Key: l.Key + name}
+}
+
+func isS3URI(s string) bool {
+	return strings.HasPrefix(s, "s3://")
+}
+
+func parseS3URI(s string) (s3Location, error) {
+	rest, ok := strings.CutPrefix(s, "s3://")
+	bucket, key, _ := strings.Cut(rest, "/")
+	if !ok || bucket == "" {
+		return s3Location{}, clierr.New(clierr.KindInput, "Expected an s3://bucket/key location, got %q", s)
+	}
+	return s3Location{Bucket: bucket, Key: key}, nil
+}
+
+// parseObjectURI parses the location of a single object, rejecting prefixes.
+func parseObjectURI(s string) (s3Location, error) {
+	loc, err := parseS3URI(s)
+	if err != nil {
+		return s3Location{}, err
+	}
+	if loc.Key == "" || strings.HasSuffix(loc.Key, "/") {
+		return s3Location{}, clierr.New(clierr.KindInput, "%s is a prefix, not an object", s)
+	}
+	return loc, nil
+}
+
+// objectArg parses an object given as s3://bucket/key or bucket/key.
+func objectArg(s string) (s3Location, error) {
+	if !isS3URI(s) {
+		s = "s3://" + s
+	}
+	return parseObjectURI(s)
+}
+
+// s3Cmd groups the commands that work on objects and bucket settings.
+func s3Cmd(clients ClientFactory) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "s3",
+		Short: "Transfer, share, inspect and audit S3 objects and buckets",
+		Long: `Transfer, share, inspect and audit S3 objects and buckets.
+
+Locations are written s3://bucket/key; a key ending in "/" is a prefix.`,
+	}
+
+	cmd.AddCommand(s3GetCmd(clients))
+	cmd.AddCommand(s3PutCmd(clients))
+	cmd.AddCommand(s3CopyCmd(clients))
+	cmd.AddCommand(s3RemoveCmd(clients))
+	cmd.AddCommand(s3SyncCmd(clients))
+	cmd.AddCommand(s3PresignCmd(clients))
+	cmd.AddCommand(s3HeadCmd(clients))
+	cmd.AddCommand(s3AuditCmd(clients))
+	return cmd
+}
+
+func s3GetCmd(clients ClientFactory) *cobra.Command {
+	var concurrency int
+
+	cmd := &cobra.Command{
+		Use:   "get s3://bucket/key [file|-]",
+		Short: "Download an object to a file or stdout",
+		Long: `Download an object to a file, named after the key unless given, or to
+stdout with "-". Large objects are fetched in parts, --concurrency at a time.`,
+		Example: `  devctl aws s3 get s3://builds/app/1.4.2.tar.gz
+  devctl aws s3 get s3://config/prod.env - | grep DATABASE`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Object location is required")
+			}
+			src, err := parseObjectURI(args[0])
+			if err != nil {
+				return err
+			}
+			dest := path.Base(src.Key)
+			if len(args) > 1 {
+				dest = args[1]
+			}
+			ctx := cmd.Context()
+
+			client, err := clients.S3(ctx)
+			if err != nil {
+				return err
+			}
+			if dest == "-" {
+				obj, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(src.Bucket), Key: aws.String(src.Key)})
+				if err != nil {
+					return awsError(err, "Failed to download %s", src)
+				}
+				defer obj.Body.Close()
+				_, err = io.Copy(cmd.OutOrStdout(), obj.Body)
+				return err
+			}
+
+			if info, err := os.Stat(dest); err == nil && info.IsDir() {
+				dest = filepath.Join(dest, path.Base(src.Key))
+			}
+			n, err := downloadFile(ctx, client, src, dest, concurrency)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✅ Downloaded %s to %s (%d bytes)\n", src, dest, n)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&concurrency, "concurrency", manager.DefaultDownloadConcurrency, "Parts downloaded in parallel")
+	return cmd
+}
+
+func s3PutCmd(clients ClientFactory) *cobra.Command {
+	var concurrency int
+
+	cmd := &cobra.Command{
+		Use:   "put <file|-> s3://bucket/key",
+		Short: "Upload a file or stdin as an object",
+		Long: `Upload a file, or stdin with "-". A key ending in "/" takes the file name.
+Files larger than 5 MiB are uploaded in parts, --concurrency at a time.`,
+		Example: `  devctl aws s3 put dist/app.tar.gz s3://builds/app/
+  pg_dump prod | devctl aws s3 put - s3://backups/prod.sql`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return clierr.New(clierr.KindInput, "File and destination are required")
+			}
+			src := args[0]
+			dst, err := parseS3URI(args[1])
+			if err != nil {
+				return err
+			}
+			if dst.Key == "" || strings.HasSuffix(dst.Key, "/") {
+				if src == "-" {
+					return clierr.New(clierr.KindInput, "Uploading stdin needs a full object key")
+				}
+				dst = dst.child(filepath.Base(src))
+			}
+
+			body := cmd.InOrStdin()
+			if src != "-" {
+				f, err := os.Open(src)
+				if err != nil {
+					return clierr.Wrap(clierr.KindInput, err, "Cannot read %s", src)
+				}
+				defer f.Close()
+				body = f
+			}
+
+			client, err := clients.S3(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if err := uploadObject(cmd.Context(), newUploader(client, concurrency), body, dst); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✅ Uploaded %s to %s\n", src, dst)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&concurrency, "concurrency", manager.DefaultUploadConcurrency, "Parts uploaded in parallel")
+	return cmd
+}
+
+func s3CopyCmd(clients ClientFactory) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cp s3://bucket/key s3://bucket/key",
+		Short: "Copy an object within or between buckets",
+		Long: `Copy an object server-side, keeping its metadata. A destination ending in
+"/" keeps the source name. Objects larger than 5 GiB can't be copied in one
+request; download and upload them instead.`,
+		Example: `  devctl aws s3 cp s3://builds/app/1.4.2.tar.gz s3://releases/app/`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return clierr.New(clierr.KindInput, "Source and destination are required")
+			}
+			src, err := parseObjectURI(args[0])
+			if err != nil {
+				return err
+			}
+			dst, err := parseS3URI(args[1])
+			if err != nil {
+				return err
+			}
+			if dst.Key == "" || strings.HasSuffix(dst.Key, "/") {
+				dst = dst.child(path.Base(src.Key))
+			}
+			ctx := cmd.Context()
+
+			client, err := clients.S3(ctx)
+			if err != nil {
+				return err
+			}
+			head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(src.Bucket), Key: aws.String(src.Key)})
+			if err != nil {
+				return awsError(err, "Failed to look up %s", src)
+			}
+			if aws.ToInt64(head.ContentLength) > maxCopySize {
+				return clierr.New(clierr.KindInput, "%s is larger than 5 GiB; use get and put to copy it", src)
+			}
+
+			_, err = client.CopyObject(ctx, &s3.CopyObjectInput{
+				Bucket:     aws.String(dst.Bucket),
+				Key:        aws.String(dst.Key),
+				CopySource: aws.String(copySource(src)),
+			})
+			if err != nil {
+				return awsError(err, "Failed to copy %s to %s", src, dst)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✅ Copied %s to %s\n", src, dst)
+			return nil
+		},
+	}
+}
+
+// copySource is the URL-encoded bucket/key CopyObject expects.
+func copySource(src s3Location) string {
+	segments := strings.Split(src.Key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return src.Bucket + "/" + strings.Join(segments, "/")
+}
+
+func s3RemoveCmd(clients ClientFactory) *cobra.Command {
+	var recursive, dryRun, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "rm s3://bucket/key",
+		Short: "Delete an object, or every object under a prefix",
+		Long: `Delete an object or, with --recursive, every object whose key starts with
+the given prefix. The objects are listed and confirmed before anything is
+deleted.`,
+		Example: `  devctl aws s3 rm s3://builds/app/1.4.2.tar.gz
+  devctl aws s3 rm s3://builds/tmp/ --recursive --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Object location is required")
+			}
+			loc, err := parseS3URI(args[0])
+			if err != nil {
+				return err
+			}
+			if !recursive && (loc.Key == "" || strings.HasSuffix(loc.Key, "/")) {
+				return clierr.New(clierr.KindInput, "%s is a prefix; pass --recursive to delete everything under it", loc)
+			}
+			ctx := cmd.Context()
+			out := cmd.OutOrStdout()
+
+			client, err := clients.S3(ctx)
+			if err != nil {
+				return err
+			}
+			var keys []string
+			if recursive {
+				objects, err := listObjects(ctx, client, loc)
+				if err != nil {
+					return err
+				}
+				for _, obj := range objects {
+					keys = append(keys, aws.ToString(obj.Key))
+				}
+			} else {
+				_, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(loc.Bucket), Key: aws.String(loc.Key)})
+				if err != nil {
+					return awsError(err, "Failed to look up %s", loc)
+				}
+				keys = []string{loc.Key}
+			}
+			if len(keys) == 0 {
+				return clierr.New(clierr.KindNotFound, "No objects under %s", loc)
+			}
+
+			for i, key := range keys {
+				if i == maxListed {
+					fmt.Fprintf(out, "  ... and %d more\n", len(keys)-i)
+					break
+				}
+				fmt.Fprintf(out, "  s3://%s/%s\n", loc.Bucket, key)
+			}
+			if dryRun {
+				fmt.Fprintf(out, "\n🔍 Dry run: would delete %d objects.\n", len(keys))
+				return nil
+			}
+			if !yes {
+				ok, err := prompt.Confirm(cmd.InOrStdin(), cmd.ErrOrStderr(),
+					fmt.Sprintf("Delete %d objects from s3://%s?", len(keys), loc.Bucket))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return clierr.New(clierr.KindAborted, "Delete cancelled")
+				}
+			}
+
+			if err := deleteObjects(ctx, cmd.ErrOrStderr(), client, loc.Bucket, keys); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "✅ Deleted %d objects.\n", len(keys))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Delete every object under the prefix")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the objects without deleting them")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+	return cmd
+}
+
+// listObjects returns every object whose key starts with the prefix loc.
+func listObjects(ctx context.Context, client S3API, loc s3Location) ([]s3types.Object, error) {
+	var objects []s3types.Object
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(loc.Bucket),
+		Prefix: aws.String(loc.Key),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, awsError(err, "Unable to list objects under %s", loc)
+		}
+		objects = append(objects, page.Contents...)
+	}
+	return objects, nil
+}
+
+// deleteObjects deletes keys in batches. Keys S3 refuses to delete are
+// reported on w and counted in the returned error.
+func deleteObjects(ctx context.Context, w io.Writer, client S3API, bucket string, keys []string) error {
+	var failed int
+	for batch := range slices.Chunk(keys, maxDeleteBatch) {
+		ids := make([]s3types.ObjectIdentifier, len(batch))
+		for i, key := range batch {
+			ids[i] = s3types.ObjectIdentifier{Key: aws.String(key)}
+		}
+		out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3types.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return awsError(err, "Failed to delete objects from s3://%s", bucket)
+		}
+		for _, e := range out.Errors {
+			fmt.Fprintf(w, "⚠️ s3://%s/%s: %s\n", bucket, aws.ToString(e.Key), aws.ToString(e.Message))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return clierr.New(clierr.KindRemote, "%d of %d objects could not be deleted", failed, len(keys))
+	}
+	return nil
+}
+
+func newUploader(client S3API, concurrency int) *manager.Uploader {
+	return manager.NewUploader(client, func(u *manager.Uploader) {
+		if concurrency > 0 {
+			u.Concurrency = concurrency
+		}
+	})
+}
+
+// uploadObject uploads body to dst, in parts when it is large, with the
+// content type guessed from the key.
+func uploadObject(ctx context.Context, uploader *manager.Uploader, body io.Reader, dst s3Location) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(dst.Bucket),
+		Key:    aws.String(dst.Key),
+		Body:   body,
+	}
+	if contentType := mime.TypeByExtension(path.Ext(dst.Key)); contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if _, err := uploader.Upload(ctx, input); err != nil {
+		return awsError(err, "Failed to upload %s", dst)
+	}
+	return nil
+}
+
+// downloadFile writes the object to dest through a temporary file, so an
+// interrupted download never leaves a truncated file behind.
+func downloadFile(ctx context.Context, client S3API, src s3Location, dest string, concurrency int) (int64, error) {
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dest)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	downloader := manager.NewDownloader(client, func(d *manager.Downloader) {
+		if concurrency > 0 {
+			d.Concurrency = concurrency
+		}
+	})
+	n, err := downloader.Download(ctx, tmp, &s3.GetObjectInput{Bucket: aws.String(src.Bucket), Key: aws.String(src.Key)})
+	if err != nil {
+		tmp.Close()
+		return 0, awsError(err, "Failed to download %s", src)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), dest)
+}
+
+// syncFile is a file to transfer, named by its slash-separated path below
+// the directory and the prefix.
+type syncFile struct {
+	rel    string
+	size   int64
+	reason string
+}
+
+func s3SyncCmd(clients ClientFactory) *cobra.Command {
+	var concurrency int
+	var sizeOnly, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "sync <dir> s3://bucket/prefix | sync s3://bucket/prefix <dir>",
+		Short: "Transfer the files that differ between a directory and a prefix",
+		Long: `Compare a local directory with an S3 prefix and upload, or download, the
+files that are missing or differ on the other side. Files with the same size
+are compared by the MD5 in the object's ETag; multipart ETags are computed
+with the part size devctl uploads with, so objects uploaded in other part
+sizes are transferred again unless --size-only is given.
+
+Files are transferred --concurrency at a time and large uploads are split
+into parts. Nothing is deleted on either side.`,
+		Example: `  devctl aws s3 sync ./site s3://www.example.com/
+  devctl aws s3 sync s3://backups/db/ ./restore --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return clierr.New(clierr.KindInput, "Source and destination are required")
+			}
+			var dir, uri string
+			upload := isS3URI(args[1])
+			switch {
+			case upload && !isS3URI(args[0]):
+				dir, uri = args[0], args[1]
+			case !upload && isS3URI(args[0]):
+				uri, dir = args[0], args[1]
+			default:
+				return clierr.New(clierr.KindInput, "sync needs a local directory and an s3:// location")
+			}
+			if concurrency < 1 {
+				return clierr.New(clierr.KindInput, "--concurrency must be at least 1")
+			}
+			loc, err := parseS3URI(uri)
+			if err != nil {
+				return err
+			}
+			if loc.Key != "" && !strings.HasSuffix(loc.Key, "/") {
+				loc.Key += "/"
+			}
+			ctx := cmd.Context()
+			out := cmd.OutOrStdout()
+
+			local, err := localFiles(dir, upload)
+			if err != nil {
+				return err
+			}
+			client, err := clients.S3(ctx)
+			if err != nil {
+				return err
+			}
+			objects, err := listObjects(ctx, client, loc)
+			if err != nil {
+				return err
+			}
+			remote := map[string]s3types.Object{}
+			for _, obj := range objects {
+				rel := strings.TrimPrefix(aws.ToString(obj.Key), loc.Key)
+				// zero-byte "folder" markers have no local counterpart
+				if rel == "" || strings.HasSuffix(rel, "/") {
+					continue
+				}
+				// keys such as "../.ssh/authorized_keys" would land outside dir
+				if !filepath.IsLocal(filepath.FromSlash(rel)) {
+					if !upload {
+						fmt.Fprintf(cmd.ErrOrStderr(), "⚠️ Skipping %s: it does not map to a path inside %s\n", aws.ToString(obj.Key), dir)
+					}
+					continue
+				}
+				remote[rel] = obj
+			}
+
+			plan, unchanged, err := planSync(dir, local, remote, upload, sizeOnly)
+			if err != nil {
+				return err
+			}
+			verb := "download"
+			if upload {
+				verb = "upload"
+			}
+			if len(plan) == 0 {
+				fmt.Fprintf(out, "✅ Nothing to %s; %d files are up to date.\n", verb, unchanged)
+				return nil
+			}
+			if dryRun {
+				for _, f := range plan {
+					fmt.Fprintf(out, "  %s %s (%s)\n", verb, f.rel, f.reason)
+				}
+				fmt.Fprintf(out, "\n🔍 Dry run: would %s %d files; %d are up to date.\n", verb, len(plan), unchanged)
+				return nil
+			}
+
+			uploader := newUploader(client, 0)
+			transfer := func(ctx context.Context, f syncFile) error {
+				name := filepath.Join(dir, filepath.FromSlash(f.rel))
+				if !upload {
+					_, err := downloadFile(ctx, client, loc.child(f.rel), name, 0)
+					return err
+				}
+				file, err := os.Open(name)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				return uploadObject(ctx, uploader, file, loc.child(f.rel))
+			}
+			if err := syncFiles(ctx, cmd, concurrency, verb, plan, transfer); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "✅ %sed %d files; %d were up to date.\n", strings.ToUpper(verb[:1])+verb[1:], len(plan), unchanged)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "Files transferred in parallel")
+	cmd.Flags().BoolVar(&sizeOnly, "size-only", false, "Compare sizes only, skipping the ETag check")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be transferred without transferring")
+	return cmd
+}
+
+// localFiles returns the size of every regular file below dir by its
+// slash-separated relative path. A missing directory is an error only when
+// it is the source.
+func localFiles(dir string, source bool) (map[string]int64, error) {
+	files := map[string]int64{}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info.Size()
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) && !source {
+		return files, nil
+	}
+	if err != nil {
+		return nil, clierr.Wrap(clierr.KindInput, err, "Cannot read %s", dir)
+	}
+	return files, nil
+}
+
+// planSync returns the files of the source side that are missing or differ
+// on the other side, in path order, and how many are already in sync.
+func planSync(dir string, local map[string]int64, remote map[string]s3types.Object, upload, sizeOnly bool) ([]syncFile, int, error) {
+	sizes := map[string]int64{}
+	if upload {
+		sizes = local
+	} else {
+		for rel, obj := range remote {
+			sizes[rel] = aws.ToInt64(obj.Size)
+		}
+	}
+
+	var plan []syncFile
+	var unchanged int
+	for _, rel := range slices.Sorted(maps.Keys(sizes)) {
+		size := sizes[rel]
+		obj, inRemote := remote[rel]
+		localSize, inLocal := local[rel]
+		switch {
+		case !inRemote || !inLocal:
+			plan = append(plan, syncFile{rel: rel, size: size, reason: "new"})
+			continue
+		case localSize != aws.ToInt64(obj.Size):
+			plan = append(plan, syncFile{rel: rel, size: size, reason: "size differs"})
+			continue
+		case sizeOnly:
+			unchanged++
+			continue
+		}
+
+		etag, err := fileETag(filepath.Join(dir, filepath.FromSlash(rel)), localSize)
+		if err != nil {
+			return nil, 0, clierr.Wrap(clierr.KindInput, err, "Cannot read %s", rel)
+		}
+		if etag != strings.Trim(aws.ToString(obj.ETag), `"`) {
+			plan = append(plan, syncFile{rel: rel, size: size, reason: "content differs"})
+		} else {
+			unchanged++
+		}
+	}
+	return plan, unchanged, nil
+}
+
+// syncFiles runs transfer for every file with at most concurrency in
+// flight, printing each file as it finishes. Failures are reported on
+// stderr and counted in the returned error.
+func syncFiles(ctx context.Context, cmd *cobra.Command, concurrency int, verb string, plan []syncFile,
+	transfer func(context.Context, syncFile) error) error {
+	errs := make([]error, len(plan))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, f := range plan {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			errs[i] = transfer(ctx, f)
+			mu.Lock()
+			defer mu.Unlock()
+			if errs[i] != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "⚠️ %s: %v\n", f.rel, errs[i])
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s %s (%s)\n", verb, f.rel, f.reason)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failed int
+	var first error
+	for _, err := range errs {
+		if err != nil {
+			failed++
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	if failed > 0 {
+		return clierr.Wrap(clierr.KindOf(first), first, "%d of %d transfers failed", failed, len(plan))
+	}
+	return nil
+}
+
+// fileETag computes the ETag S3 gives the file when devctl uploads it: the
+// MD5 of the content or, for multipart uploads, the MD5 of the part MD5s
+// followed by the number of parts.
+func fileETag(name string, size int64) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	partSize := uploadPartSize(size)
+	if size <= partSize {
+		h := md5.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	var sums []byte
+	var parts int
+	for {
+		h := md5.New()
+		n, err := io.CopyN(h, f, partSize)
+		if n > 0 {
+			sums = h.Sum(sums)
+			parts++
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts), nil
+}
+
+// uploadPartSize mirrors how the transfer manager sizes parts: the default,
+// raised when the object would otherwise need too many parts.
+func uploadPartSize(size int64) int64 {
+	partSize := int64(manager.DefaultUploadPartSize)
+	if size/partSize >= int64(manager.MaxUploadParts) {
+		partSize = size/int64(manager.MaxUploadParts) + 1
+	}
+	return partSize
+}
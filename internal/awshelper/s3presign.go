@@ -0,0 +1,104 @@
+package awshelper
+
+import (
+	"devctl/pkg/clierr"
+	"devctl/pkg/printer"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/spf13/cobra"
+)
+
+// maxPresignExpiry is the longest SigV4 lets a presigned URL stay valid.
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+func s3PresignCmd(clients ClientFactory) *cobra.Command {
+	var method, contentType string
+	var expires time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "presign <bucket>/<key>",
+		Short: "Print a temporary URL to download or upload an object",
+		Long: `Print a presigned URL that lets anyone holding it download the object, or
+upload it with --method PUT, without AWS credentials until it expires.
+
+URLs signed with temporary credentials, e.g. those of an assumed role, stop
+working when the credentials expire, even if --expires is later.`,
+		Example: `  devctl aws s3 presign builds/app/1.4.2.tar.gz --expires 24h
+  curl -T app.tar.gz "$(devctl aws s3 presign s3://builds/app/1.4.3.tar.gz --method PUT)"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Object location is required")
+			}
+			loc, err := objectArg(args[0])
+			if err != nil {
+				return err
+			}
+			if expires <= 0 || expires > maxPresignExpiry {
+				return clierr.New(clierr.KindInput, "--expires must be between 1s and %s", maxPresignExpiry)
+			}
+			method = strings.ToUpper(method)
+			if method != http.MethodGet && method != http.MethodPut {
+				return clierr.New(clierr.KindInput, "--method must be GET or PUT, got %q", method)
+			}
+			if contentType != "" && method != http.MethodPut {
+				return clierr.New(clierr.KindInput, "--content-type only applies to --method PUT")
+			}
+			ctx := cmd.Context()
+
+			client, err := clients.S3Presign(ctx)
+			if err != nil {
+				return err
+			}
+			var req *v4.PresignedHTTPRequest
+			if method == http.MethodGet {
+				req, err = client.PresignGetObject(ctx, &s3.GetObjectInput{
+					Bucket: aws.String(loc.Bucket),
+					Key:    aws.String(loc.Key),
+				}, s3.WithPresignExpires(expires))
+			} else {
+				input := &s3.PutObjectInput{Bucket: aws.String(loc.Bucket), Key: aws.String(loc.Key)}
+				if contentType != "" {
+					input.ContentType = aws.String(contentType)
+				}
+				req, err = client.PresignPutObject(ctx, input, s3.WithPresignExpires(expires))
+			}
+			if err != nil {
+				return awsError(err, "Failed to presign %s", loc)
+			}
+
+			// the URL alone goes to stdout so it can be captured
+			fmt.Fprintln(cmd.OutOrStdout(), req.URL)
+			until := time.Now().Add(expires)
+			fmt.Fprintf(cmd.ErrOrStderr(), "⏳ Valid until %s\n", printer.Time(&until))
+			if method == http.MethodPut {
+				fmt.Fprintf(cmd.ErrOrStderr(), "👉 Upload with: curl -X PUT%s -T <file> '%s'\n", curlHeaders(req.SignedHeader), req.URL)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&method, "method", http.MethodGet, "HTTP method the URL allows: GET or PUT")
+	cmd.Flags().DurationVar(&expires, "expires", time.Hour, "How long the URL stays valid, at most 168h")
+	cmd.Flags().StringVar(&contentType, "content-type", "", "Content type the upload must be sent with (PUT only)")
+	return cmd
+}
+
+// curlHeaders renders the headers a presigned request was signed with, which
+// the client has to send as well. Host is set by curl itself.
+func curlHeaders(header http.Header) string {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(header)) {
+		if name != "Host" {
+			fmt.Fprintf(&b, " -H '%s: %s'", name, header.Get(name))
+		}
+	}
+	return b.String()
+}
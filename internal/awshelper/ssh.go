@@ -0,0 +1,284 @@
+package awshelper
+
+import (
+	"bytes"
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/runner"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/spf13/cobra"
+)
+
+const sessionManagerPluginURL = "https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html"
+
+// sshOptions are the ssh-ec2 flags that shape the ssh command line.
+type sshOptions struct {
+	keyPath         string
+	username        string
+	bastion         string
+	instanceConnect bool
+}
+
+func sshEC2Cmd(clients ClientFactory) *cobra.Command {
+	var instanceID, name string
+	var useSSM bool
+	var opts sshOptions
+
+	cmd := &cobra.Command{
+		Use:   "ssh-ec2 [instance-id|name]",
+		Short: "SSH into an EC2 instance, directly, through a bastion or with SSM Session Manager",
+		Long: `SSH into an EC2 instance given by ID or Name tag.
+
+Instances with a public IP are reached directly; with --bastion the private IP is
+reached through the jump host. Instances without a route fall back to SSM
+Session Manager when the SSM agent is online, and --ssm always uses it.`,
+		Example: `  devctl aws ssh-ec2 i-0123456789abcdef0 -k ~/.ssh/prod.pem
+  devctl aws ssh-ec2 web-1 --bastion ec2-user@bastion.example.com --instance-connect
+  devctl aws ssh-ec2 --name worker-3 --ssm`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				if strings.HasPrefix(args[0], "i-") {
+					instanceID = args[0]
+				} else {
+					name = args[0]
+				}
+			}
+			if instanceID == "" && name == "" {
+				return clierr.New(clierr.KindInput, "Instance ID or name is required")
+			}
+			ctx := cmd.Context()
+
+			client, err := clients.EC2(ctx)
+			if err != nil {
+				return err
+			}
+			inst, err := findInstance(ctx, client, instanceID, name)
+			if err != nil {
+				return err
+			}
+			id := aws.ToString(inst.InstanceId)
+
+			host := aws.ToString(inst.PublicIpAddress)
+			if opts.bastion != "" {
+				host = aws.ToString(inst.PrivateIpAddress)
+			}
+			if !useSSM && host == "" {
+				online, err := ssmOnline(ctx, clients, id)
+				if err != nil {
+					return err
+				}
+				if !online {
+					return clierr.New(clierr.KindInput, "Instance %s has no public IP and no online SSM agent; use --bastion", id)
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "🔁 %s has no public IP; connecting with SSM Session Manager\n", id)
+				useSSM = true
+			}
+
+			if useSSM {
+				return startSSMSession(ctx, cmd, clients, id)
+			}
+			return sshInstance(ctx, cmd, clients, id, host, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&instanceID, "instance-id", "i", "", "EC2 instance ID")
+	cmd.Flags().StringVar(&name, "name", "", "Connect to the running instance with this Name tag")
+	cmd.Flags().StringVarP(&opts.keyPath, "key", "k", "", "Path to private key file")
+	cmd.Flags().StringVarP(&opts.username, "user", "u", "", "SSH username (default: ec2-user)")
+	cmd.Flags().StringVar(&opts.bastion, "bastion", "", "Jump host, as [user@]host[:port], used to reach the private IP")
+	cmd.Flags().BoolVar(&opts.instanceConnect, "instance-connect", false, "Push the public key with EC2 Instance Connect before connecting; without --key a temporary key is used")
+	cmd.Flags().BoolVar(&useSSM, "ssm", false, "Connect with SSM Session Manager instead of SSH")
+	return cmd
+}
+
+// findInstance looks an instance up by ID or, without one, by its Name tag.
+// A name must match exactly one running instance.
+func findInstance(ctx context.Context, client EC2API, instanceID, name string) (ec2types.Instance, error) {
+	if instanceID != "" {
+		return describeInstance(ctx, client, instanceID)
+	}
+
+	instances, err := selectInstances(ctx, client, nil, []ec2types.Filter{
+		{Name: aws.String("tag:Name"), Values: []string{name}},
+		{Name: aws.String("instance-state-name"), Values: []string{string(ec2types.InstanceStateNameRunning)}},
+	})
+	if clierr.KindOf(err) == clierr.KindNotFound {
+		return ec2types.Instance{}, clierr.New(clierr.KindNotFound, "No running instance is named %s", name)
+	}
+	if err != nil {
+		return ec2types.Instance{}, err
+	}
+	if len(instances) > 1 {
+		var ids []string
+		for _, inst := range instances {
+			ids = append(ids, aws.ToString(inst.InstanceId))
+		}
+		return ec2types.Instance{}, clierr.New(clierr.KindInput, "%d running instances are named %s (%s); pass an instance ID",
+			len(instances), name, strings.Join(ids, ", "))
+	}
+	return instances[0], nil
+}
+
+// ssmOnline reports whether the SSM agent on the instance is connected.
+func ssmOnline(ctx context.Context, clients ClientFactory, instanceID string) (bool, error) {
+	client, err := clients.SSM(ctx)
+	if err != nil {
+		return false, err
+	}
+	out, err := client.DescribeInstanceInformation(ctx, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{{Key: aws.String("InstanceIds"), Values: []string{instanceID}}},
+	})
+	if err != nil {
+		return false, awsError(err, "Failed to look up the SSM agent of %s", instanceID)
+	}
+	for _, info := range out.InstanceInformationList {
+		if info.PingStatus == ssmtypes.PingStatusOnline {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// startSSMSession opens a shell on the instance. Like the AWS CLI, it starts
+// the session with the API and hands the stream to session-manager-plugin.
+func startSSMSession(ctx context.Context, cmd *cobra.Command, clients ClientFactory, instanceID string) error {
+	if _, err := exec.LookPath("session-manager-plugin"); err != nil {
+		return clierr.New(clierr.KindInput, "SSM sessions need the Session Manager plugin; see %s", sessionManagerPluginURL)
+	}
+
+	client, err := clients.SSM(ctx)
+	if err != nil {
+		return err
+	}
+	options := client.Options()
+	endpoint, err := ssmEndpoint(ctx, options)
+	if err != nil {
+		return err
+	}
+	session, err := client.StartSession(ctx, &ssm.StartSessionInput{Target: aws.String(instanceID)})
+	if err != nil {
+		return awsError(err, "Failed to start an SSM session on %s", instanceID)
+	}
+
+	response, err := json.Marshal(map[string]string{
+		"SessionId":  aws.ToString(session.SessionId),
+		"StreamUrl":  aws.ToString(session.StreamUrl),
+		"TokenValue": aws.ToString(session.TokenValue),
+	})
+	if err != nil {
+		return err
+	}
+	request, err := json.Marshal(map[string]string{"Target": instanceID})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "👉 Starting SSM session %s on %s\n", aws.ToString(session.SessionId), instanceID)
+	// an empty profile leaves the plugin on the default credential chain
+	return clierr.Process(runner.Command("session-manager-plugin",
+		string(response), options.Region, "StartSession", "", string(request), endpoint).Run(ctx))
+}
+
+// ssmEndpoint returns the SSM endpoint the plugin should talk to, resolved
+// the way the SDK resolves it so --endpoint-url and other partitions apply.
+func ssmEndpoint(ctx context.Context, options ssm.Options) (string, error) {
+	resolver := options.EndpointResolverV2
+	if resolver == nil {
+		resolver = ssm.NewDefaultEndpointResolverV2()
+	}
+	endpoint, err := resolver.ResolveEndpoint(ctx, ssm.EndpointParameters{
+		Region:       aws.String(options.Region),
+		Endpoint:     options.BaseEndpoint,
+		UseFIPS:      aws.Bool(options.EndpointOptions.UseFIPSEndpoint == aws.FIPSEndpointStateEnabled),
+		UseDualStack: aws.Bool(options.EndpointOptions.UseDualStackEndpoint == aws.DualStackEndpointStateEnabled),
+	})
+	if err != nil {
+		return "", clierr.Wrap(clierr.KindInput, err, "Cannot resolve the SSM endpoint for %s", options.Region)
+	}
+	return endpoint.URI.String(), nil
+}
+
+// sshInstance runs ssh against host, pushing the key with Instance Connect
+// first when asked to.
+func sshInstance(ctx context.Context, cmd *cobra.Command, clients ClientFactory, instanceID, host string, opts sshOptions) error {
+	user := opts.username
+	if user == "" {
+		user = "ec2-user"
+	}
+
+	var args []string
+	keyPath := opts.keyPath
+	if opts.instanceConnect {
+		key, cleanup, err := instanceConnectKey(ctx, keyPath)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		publicKey, err := os.ReadFile(key + ".pub")
+		if err != nil {
+			return clierr.Wrap(clierr.KindInput, err, "Instance Connect needs the public key %s.pub", key)
+		}
+
+		client, err := clients.InstanceConnect(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = client.SendSSHPublicKey(ctx, &ec2instanceconnect.SendSSHPublicKeyInput{
+			InstanceId:     aws.String(instanceID),
+			InstanceOSUser: aws.String(user),
+			SSHPublicKey:   aws.String(strings.TrimSpace(string(publicKey))),
+		})
+		if err != nil {
+			return awsError(err, "Failed to push the SSH key to %s", instanceID)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "🔐 Pushed a key for %s@%s; it is accepted for 60 seconds\n", user, instanceID)
+		keyPath = key
+		args = append(args, "-o", "IdentitiesOnly=yes")
+	}
+	if keyPath != "" {
+		args = append(args, "-i", keyPath)
+	}
+	if opts.bastion != "" {
+		args = append(args, "-J", opts.bastion)
+	}
+	// "--" keeps a --user starting with "-" from being read as an option
+	args = append(args, "--", user+"@"+host)
+
+	ssh := runner.Command("ssh", args...)
+	ssh.Echo = true
+	// ssh reports its own errors; keep its exit code for the caller
+	return clierr.Process(ssh.Run(ctx))
+}
+
+// instanceConnectKey returns the private key to push with Instance Connect:
+// keyPath when given, otherwise a throwaway key removed by cleanup.
+func instanceConnectKey(ctx context.Context, keyPath string) (key string, cleanup func(), err error) {
+	if keyPath != "" {
+		return keyPath, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "devctl-ssh-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	key = filepath.Join(dir, "id_ed25519")
+	var out bytes.Buffer
+	keygen := runner.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "devctl", "-f", key)
+	keygen.Stdin, keygen.Stdout, keygen.Stderr = nil, &out, &out
+	if err := keygen.Run(ctx); err != nil {
+		cleanup()
+		return "", nil, clierr.Wrap(clierr.KindUnknown, err, "Failed to generate a temporary SSH key: %s", strings.TrimSpace(out.String()))
+	}
+	return key, cleanup, nil
+}
@@ -0,0 +1,329 @@
+package awshelper
+
+import (
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/color"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/spf13/cobra"
+)
+
+// eventTail prints the events of a stack as CloudFormation publishes them.
+// With nested set, the events of nested stacks are followed as well and
+// printed under the nested stack's logical ID; otherwise a nested stack shows
+// up only as its own resource in the parent.
+type eventTail struct {
+	client   CloudFormationAPI
+	stack    string
+	w        io.Writer
+	nested   bool
+	prefix   string
+	seen     map[string]bool
+	children map[string]*eventTail
+}
+
+// newEventTail follows stack, which should be a stack ID when the stack is
+// being deleted: deleted stacks can't be looked up by name.
+func newEventTail(client CloudFormationAPI, stack string, w io.Writer) *eventTail {
+	return &eventTail{client: client, stack: stack, w: w, seen: map[string]bool{}, children: map[string]*eventTail{}}
+}
+
+// skipExisting marks the events published so far as seen, so only the
+// events of the operation about to start are printed.
+func (t *eventTail) skipExisting(ctx context.Context) error {
+	_, err := t.history(ctx, 0)
+	return err
+}
+
+// history prints the last n events published so far, oldest first, marks
+// the rest as seen and returns the printed events.
+func (t *eventTail) history(ctx context.Context, n int) ([]cftypes.StackEvent, error) {
+	out, err := t.client.DescribeStackEvents(ctx, &cloudformation.DescribeStackEventsInput{StackName: aws.String(t.stack)})
+	if err != nil {
+		return nil, awsError(err, "Failed to get events for stack %s", t.stack)
+	}
+	for _, e := range out.StackEvents {
+		t.seen[aws.ToString(e.EventId)] = true
+	}
+	recent := out.StackEvents
+	if len(recent) > n {
+		recent = recent[:n]
+	}
+	events := t.print(recent)
+
+	// nested stacks already running get the same treatment
+	primed := map[*eventTail]bool{}
+	for _, e := range out.StackEvents {
+		if child := t.child(e); child != nil && !primed[child] {
+			primed[child] = true
+			if err := child.skipExisting(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return events, nil
+}
+
+// poll prints the events published since the last call, oldest first, and
+// returns them.
+func (t *eventTail) poll(ctx context.Context) ([]cftypes.StackEvent, error) {
+	var fresh []cftypes.StackEvent
+	paginator := cloudformation.NewDescribeStackEventsPaginator(t.client, &cloudformation.DescribeStackEventsInput{
+		StackName: aws.String(t.stack),
+	})
+pages:
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, awsError(err, "Failed to get events for stack %s", t.stack)
+		}
+		// events come newest first: stop at the first one already printed
+		for _, e := range page.StackEvents {
+			id := aws.ToString(e.EventId)
+			if t.seen[id] {
+				break pages
+			}
+			t.seen[id] = true
+			fresh = append(fresh, e)
+		}
+	}
+	events := t.print(fresh)
+
+	for _, e := range fresh {
+		t.child(e)
+	}
+	for _, child := range t.children {
+		childEvents, err := child.poll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, childEvents...)
+	}
+	return events, nil
+}
+
+// print writes events given newest first in chronological order and
+// returns them in that order. A nested stack's events about itself are
+// already printed by its parent and skipped.
+func (t *eventTail) print(newestFirst []cftypes.StackEvent) []cftypes.StackEvent {
+	events := make([]cftypes.StackEvent, 0, len(newestFirst))
+	for i := len(newestFirst) - 1; i >= 0; i-- {
+		e := newestFirst[i]
+		if t.prefix != "" && isStackEvent(e) {
+			continue
+		}
+		events = append(events, e)
+		printStackEvent(t.w, t.prefix, e)
+	}
+	return events
+}
+
+// child returns the tail of the nested stack an event is about, creating
+// it on first sight, or nil when nested stacks aren't followed.
+func (t *eventTail) child(e cftypes.StackEvent) *eventTail {
+	if !t.nested || !isNestedStackEvent(e) {
+		return nil
+	}
+	id := aws.ToString(e.PhysicalResourceId)
+	if child, ok := t.children[id]; ok {
+		return child
+	}
+	child := newEventTail(t.client, id, t.w)
+	child.nested = true
+	child.prefix = t.prefix + aws.ToString(e.LogicalResourceId) + "/"
+	t.children[id] = child
+	return child
+}
+
+// isStackEvent reports whether an event is about the stack itself rather
+// than one of its resources.
+func isStackEvent(e cftypes.StackEvent) bool {
+	return aws.ToString(e.PhysicalResourceId) == aws.ToString(e.StackId)
+}
+
+func isNestedStackEvent(e cftypes.StackEvent) bool {
+	return aws.ToString(e.ResourceType) == "AWS::CloudFormation::Stack" &&
+		aws.ToString(e.PhysicalResourceId) != "" && !isStackEvent(e)
+}
+
+// failedStatus reports whether a resource status means something went wrong.
+func failedStatus(status string) bool {
+	return strings.HasSuffix(status, "_FAILED") || strings.Contains(status, "ROLLBACK")
+}
+
+func printStackEvent(w io.Writer, prefix string, e cftypes.StackEvent) {
+	paint := color.For(w)
+	status := fmt.Sprintf("%-28s", e.ResourceStatus)
+	switch s := string(e.ResourceStatus); {
+	case failedStatus(s):
+		status = paint.Red(status)
+	case strings.HasSuffix(s, "_IN_PROGRESS"):
+		status = paint.Yellow(status)
+	case strings.HasSuffix(s, "_COMPLETE"):
+		status = paint.Green(status)
+	default:
+		status = paint.Dim(status)
+	}
+
+	resource := prefix + aws.ToString(e.LogicalResourceId)
+	if isNestedStackEvent(e) {
+		resource = "▸ " + resource
+	}
+	line := fmt.Sprintf("%s  %s %-32s %s", paint.Dim(aws.ToTime(e.Timestamp).Local().Format("15:04:05")),
+		status, resource, aws.ToString(e.ResourceType))
+	if reason := aws.ToString(e.ResourceStatusReason); reason != "" {
+		line += "  " + reason
+	}
+	fmt.Fprintln(w, line)
+}
+
+// waitForStack prints the events of a stack until it leaves the
+// *_IN_PROGRESS states and returns its final status together with all
+// events seen while waiting.
+func waitForStack(ctx context.Context, client CloudFormationAPI, tail *eventTail, stack string) (cftypes.StackStatus, []cftypes.StackEvent, error) {
+	var all []cftypes.StackEvent
+	for {
+		events, err := tail.poll(ctx)
+		if err != nil {
+			return "", all, err
+		}
+		all = append(all, events...)
+
+		out, err := client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: aws.String(stack)})
+		if err != nil {
+			return "", all, awsError(err, "Failed to get status of stack %s", stack)
+		}
+		if len(out.Stacks) == 0 {
+			return "", all, clierr.New(clierr.KindNotFound, "Stack %s not found", stack)
+		}
+		status := out.Stacks[0].StackStatus
+		if !strings.HasSuffix(string(status), "_IN_PROGRESS") {
+			// pick up the events published with the final status
+			events, err := tail.poll(ctx)
+			return status, append(all, events...), err
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, all, clierr.Wrap(clierr.KindTimeout, ctx.Err(), "Gave up waiting for stack %s (%s)", stack, status)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// printFailedResources lists the resources whose events report a failure.
+func printFailedResources(w io.Writer, header string, events []cftypes.StackEvent, stackName string) {
+	var failed []string
+	for _, e := range events {
+		if strings.HasSuffix(string(e.ResourceStatus), "_FAILED") && aws.ToString(e.LogicalResourceId) != stackName {
+			failed = append(failed, fmt.Sprintf("%s (%s): %s", aws.ToString(e.LogicalResourceId),
+				aws.ToString(e.ResourceType), aws.ToString(e.ResourceStatusReason)))
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(w, "\n%s\n  %s\n", header, strings.Join(failed, "\n  "))
+	}
+}
+
+// watchStack prints new events until the stack settles and returns how many
+// of them were failures. With follow it keeps going after the stack settles,
+// until the stack settles after a failure or ctx is cancelled; an interrupt
+// ends the watch without an error.
+func watchStack(ctx context.Context, client CloudFormationAPI, tail *eventTail, stackName string, follow bool) (int, error) {
+	var failed int
+	poll := func() error {
+		events, err := tail.poll(ctx)
+		for _, e := range events {
+			if failedStatus(string(e.ResourceStatus)) {
+				failed++
+			}
+		}
+		return err
+	}
+	for {
+		stack, err := describeStack(ctx, client, stackName)
+		if err != nil {
+			if ctx.Err() != nil {
+				return failed, nil
+			}
+			return failed, err
+		}
+		if !strings.HasSuffix(string(stack.StackStatus), "_IN_PROGRESS") && (!follow || failed > 0) {
+			// events published together with the final status
+			return failed, poll()
+		}
+		select {
+		case <-ctx.Done():
+			return failed, nil
+		case <-time.After(pollInterval):
+		}
+		if err := poll(); err != nil {
+			if ctx.Err() != nil {
+				return failed, nil
+			}
+			return failed, err
+		}
+	}
+}
+
+func stackEventsCmd(clients ClientFactory) *cobra.Command {
+	var lines int
+	var follow, nested bool
+
+	cmd := &cobra.Command{
+		Use:   "cf-events [stack]",
+		Short: "Show and follow the events of a CloudFormation stack",
+		Long: `Print the latest events of a stack and keep following new ones while an
+operation is in progress, like tail -f. Events of nested stacks are collapsed
+into the nested stack's own line unless --nested is given.
+
+Exits with code 7 when an event published after cf-events started is a
+failure or rollback, so a failed deploy can be spotted from a script. Failures
+among the past events shown at startup don't count. With --follow it stops
+once the stack settles after such a failure and otherwise runs until
+interrupted; an interrupt is not an error.`,
+		Example: `  devctl aws cf-events web
+  devctl aws cf-events web --nested --lines 0 --follow`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return clierr.New(clierr.KindInput, "Stack name is required")
+			}
+			stackName := args[0]
+			if lines < 0 {
+				return clierr.New(clierr.KindInput, "--lines must not be negative")
+			}
+
+			client, err := clients.CloudFormation(cmd.Context())
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+
+			tail := newEventTail(client, stackName, cmd.OutOrStdout())
+			tail.nested = nested
+			if _, err := tail.history(ctx, lines); err != nil {
+				return err
+			}
+			failed, err := watchStack(ctx, client, tail, stackName, follow)
+			if err != nil {
+				return err
+			}
+			if failed > 0 {
+				return clierr.New(clierr.KindCheckFailed, "Stack %s reported %d failed or rollback events", stackName, failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&lines, "lines", "n", 20, "Number of past events to show")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep following after the stack settles, until interrupted or an operation fails")
+	cmd.Flags().BoolVar(&nested, "nested", false, "Also show the events of nested stacks")
+	return cmd
+}
@@ -0,0 +1,49 @@
+package awshelper
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// deletionPolicies returns the DeletionPolicy of every resource in a
+// CloudFormation template that sets one. Templates may be JSON or YAML; YAML
+// short-form functions such as !Ref are kept as tagged nodes and ignored.
+func deletionPolicies(body string) map[string]string {
+	resources := templateSection(body, "Resources")
+	if resources == nil {
+		return nil
+	}
+	policies := map[string]string{}
+	for i := 0; i+1 < len(resources.Content); i += 2 {
+		policy := mappingValue(resources.Content[i+1], "DeletionPolicy")
+		if policy != nil && policy.Kind == yaml.ScalarNode {
+			policies[resources.Content[i].Value] = policy.Value
+		}
+	}
+	return policies
+}
+
+// templateSection returns a top-level section of a template, or nil.
+func templateSection(body, name string) *yaml.Node {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(body), &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	section := mappingValue(doc.Content[0], name)
+	if section == nil || section.Kind != yaml.MappingNode {
+		return nil
+	}
+	return section
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
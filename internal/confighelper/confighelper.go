@@ -0,0 +1,122 @@
+package confighelper
+
+import (
+	"devctl/pkg/clierr"
+	"devctl/pkg/config"
+	"devctl/pkg/printer"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func NewConfigHelperCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and change devctl configuration",
+	}
+
+	cmd.AddCommand(viewCmd())
+	cmd.AddCommand(getCmd())
+	cmd.AddCommand(setCmd())
+	cmd.AddCommand(pathCmd())
+
+	return cmd
+}
+
+var valueColumns = []printer.Column[config.Value]{
+	{Header: "Key", Value: func(v config.Value) string { return v.Key }},
+	{Header: "Value", Value: func(v config.Value) string { return v.Value }},
+	{Header: "Source", Value: func(v config.Value) string { return v.Source }},
+	{Header: "Origin", Value: func(v config.Value) string { return printer.Or(v.Origin) }},
+}
+
+var fileColumns = []printer.Column[config.File]{
+	{Header: "Scope", Value: func(f config.File) string { return f.Scope }},
+	{Header: "Path", Value: func(f config.File) string { return f.Path }},
+	{Header: "Exists", Value: func(f config.File) string { return strconv.FormatBool(f.Exists) }},
+}
+
+func viewCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "view",
+		Short: "Show every effective setting and where it came from",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printer.PrintAll(os.Stdout, printer.Output(cmd), valueColumns, config.Current().Values())
+		},
+	}
+}
+
+func getCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get [key]",
+		Short: "Print the effective value of a setting",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v, ok := config.Current().Get(args[0])
+			if !ok {
+				return clierr.New(clierr.KindNotFound, "%s is not set", args[0])
+			}
+			fmt.Println(v.Value)
+			return nil
+		},
+	}
+}
+
+func setCmd() *cobra.Command {
+	var scope string
+
+	cmd := &cobra.Command{
+		Use:   "set [key] [value]",
+		Short: "Write a setting to a configuration file",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, value := args[0], args[1]
+			if !config.Known(key) {
+				return clierr.New(clierr.KindInput, "unknown setting %q (see `devctl config view`)", key)
+			}
+
+			if err := config.Check(key, value); err != nil {
+				return clierr.Wrap(clierr.KindInput, err, "")
+			}
+			// the output format is only known to the printer
+			if key == printer.FlagName {
+				if err := printer.Validate(value); err != nil {
+					return clierr.Wrap(clierr.KindInput, err, "")
+				}
+			}
+
+			path := ""
+			for _, f := range config.Files() {
+				if f.Scope == scope {
+					path = f.Path
+				}
+			}
+			if path == "" {
+				return clierr.New(clierr.KindInput, "unknown scope %q (use system, user or project)", scope)
+			}
+
+			if err := config.Set(path, key, value); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+			fmt.Printf("✅ %s = %s (%s)\n", key, value, path)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&scope, "scope", config.ScopeUser, "File to write: system, user or project")
+	return cmd
+}
+
+func pathCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "List the configuration files in order of precedence",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printer.PrintAll(os.Stdout, printer.Output(cmd), fileColumns, config.Current().Files())
+		},
+	}
+}
@@ -1,10 +1,10 @@
 package githelper
 
 import (
-	"fmt"
-	"log"
-	"os"
-	"os/exec"
+	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/config"
+	"devctl/pkg/runner"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -31,9 +31,9 @@ func cloneCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "clone",
 		Short: "Clone a Git repository",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if repo == "" {
-				log.Fatal("❌ --repo is required")
+				return clierr.New(clierr.KindInput, "--repo is required")
 			}
 
 			args = []string{"clone", repo}
@@ -41,7 +41,7 @@ func cloneCmd() *cobra.Command {
 				args = append(args, dir)
 			}
 
-			runGitCommand(args...)
+			return runGitCommand(cmd.Context(), args...)
 		},
 	}
 
@@ -56,11 +56,11 @@ func checkoutCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "checkout",
 		Short: "Checkout a Git branch",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if branch == "" {
-				log.Fatal("❌ --branch is required")
+				return clierr.New(clierr.KindInput, "--branch is required")
 			}
-			runGitCommand("checkout", branch)
+			return runGitCommand(cmd.Context(), "checkout", branch)
 		},
 	}
 
@@ -74,13 +74,15 @@ func commitCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "commit",
 		Short: "Create a Git commit",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if message == "" {
-				log.Fatal("❌ --message is required")
+				return clierr.New(clierr.KindInput, "--message is required")
 			}
 
-			runGitCommand("add", ".")
-			runGitCommand("commit", "-m", message)
+			if err := runGitCommand(cmd.Context(), "add", "."); err != nil {
+				return err
+			}
+			return runGitCommand(cmd.Context(), "commit", "-m", message)
 		},
 	}
 
@@ -95,34 +97,30 @@ func pushCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "push",
 		Short: "Push changes to a Git remote",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			if remote == "" {
-				remote = "origin"
+				remote = config.String("git.remote")
 			}
 			if branch == "" {
-				out, err := exec.Command("git", "branch", "--show-current").Output()
+				out, err := runner.Command("git", "branch", "--show-current").Output(cmd.Context())
 				if err != nil {
-					log.Fatalf("❌ Failed to determine current branch: %v", err)
+					return clierr.Wrap(clierr.KindInput, err, "Failed to determine current branch")
 				}
 				branch = strings.TrimSpace(string(out))
 			}
-			runGitCommand("push", remote, branch)
+			return runGitCommand(cmd.Context(), "push", remote, branch)
 		},
 	}
 
-	cmd.Flags().StringVarP(&remote, "remote", "r", "origin", "Git remote")
+	cmd.Flags().StringVarP(&remote, "remote", "r", config.String("git.remote"), "Git remote")
 	cmd.Flags().StringVarP(&branch, "branch", "b", "", "Git branch")
 	return cmd
 }
 
-func runGitCommand(args ...string) {
-	cmd := exec.Command("git", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	fmt.Printf("▶️ git %s\n", strings.Join(args, " "))
-	if err := cmd.Run(); err != nil {
-		log.Fatalf("❌ git command failed: %v", err)
-	}
+// runGitCommand runs git attached to the terminal. git reports its own
+// errors, so only its exit code is passed on.
+func runGitCommand(ctx context.Context, args ...string) error {
+	c := runner.Command("git", args...)
+	c.Echo = true
+	return clierr.Process(c.Run(ctx))
 }
@@ -0,0 +1,229 @@
+package iampolicy
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Explanation describes a statement in plain language.
+type Explanation struct {
+	// Statement is the 1-based position of the statement in the policy.
+	Statement int    `json:"statement"`
+	Sid       string `json:"sid,omitempty"`
+	Effect    string `json:"effect"`
+	Summary   string `json:"summary"`
+	// Warnings flag broad grants: wildcard principals, actions and
+	// resources in Allow statements.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Explain explains every statement of p.
+func Explain(p Policy) []Explanation {
+	explanations := make([]Explanation, len(p.Statement))
+	for i, s := range p.Statement {
+		explanations[i] = s.Explain()
+		explanations[i].Statement = i + 1
+	}
+	return explanations
+}
+
+// Explain summarizes who can or cannot do what on which resources under
+// which conditions, e.g. "Anyone can s3:GetObject on arn:aws:s3:::site/*
+// when aws:SourceIp is in 203.0.113.0/24."
+func (s Statement) Explain() Explanation {
+	verb := "cannot"
+	if s.Allows() {
+		verb = "can"
+	}
+	summary := fmt.Sprintf("%s %s %s %s", s.who(), verb, s.what(), s.where())
+	if len(s.Condition) > 0 {
+		summary += " when " + s.when()
+	}
+	return Explanation{
+		Sid:      s.Sid,
+		Effect:   s.Effect,
+		Summary:  strings.ToUpper(summary[:1]) + summary[1:] + ".",
+		Warnings: s.warnings(),
+	}
+}
+
+func (s Statement) who() string {
+	switch {
+	case len(s.NotPrincipal) > 0:
+		return "anyone except " + principals(s.NotPrincipal)
+	case s.Public():
+		return "anyone"
+	case len(s.Principal) > 0:
+		return principals(s.Principal)
+	}
+	// identity policies name no principal
+	return "the attached identity"
+}
+
+func principals(p Principal) string {
+	var names []string
+	for _, kind := range slices.Sorted(maps.Keys(p)) {
+		for _, id := range p[kind] {
+			names = append(names, principalName(kind, id))
+		}
+	}
+	return joinList(names, "and")
+}
+
+var accountRoot = regexp.MustCompile(`^(?:arn:aws[\w-]*:iam::)?(\d{12})(?::root)?$`)
+
+func principalName(kind, id string) string {
+	switch kind {
+	case "AWS":
+		if m := accountRoot.FindStringSubmatch(id); m != nil {
+			return "account " + m[1]
+		}
+		return id
+	case "Service":
+		return "service " + id
+	case "Federated":
+		return "users federated by " + id
+	case "CanonicalUser":
+		return "canonical user " + id
+	}
+	return kind + " " + id
+}
+
+func (s Statement) what() string {
+	if len(s.NotAction) > 0 {
+		return "do anything except " + joinList(s.NotAction, "or")
+	}
+	if slices.Contains(s.Action, "*") {
+		return "do anything"
+	}
+	return joinList(s.Action, "and")
+}
+
+func (s Statement) where() string {
+	switch {
+	case len(s.NotResource) > 0:
+		return "on any resource except " + joinList(s.NotResource, "or")
+	case len(s.Resource) == 0:
+		// resource policies apply to the resource they are attached to
+		return "on this resource"
+	case slices.Contains(s.Resource, "*"):
+		return "on any resource"
+	}
+	return "on " + joinList(s.Resource, "and")
+}
+
+// conditionVerbs phrase the common condition operators.
+var conditionVerbs = map[string]string{
+	"StringEquals":              "is",
+	"StringNotEquals":           "is not",
+	"StringEqualsIgnoreCase":    "is, ignoring case,",
+	"StringNotEqualsIgnoreCase": "is not, ignoring case,",
+	"StringLike":                "matches",
+	"StringNotLike":             "does not match",
+	"ArnEquals":                 "is",
+	"ArnLike":                   "matches",
+	"ArnNotEquals":              "is not",
+	"ArnNotLike":                "does not match",
+	"NumericEquals":             "is",
+	"NumericNotEquals":          "is not",
+	"NumericLessThan":           "is less than",
+	"NumericLessThanEquals":     "is at most",
+	"NumericGreaterThan":        "is greater than",
+	"NumericGreaterThanEquals":  "is at least",
+	"DateEquals":                "is",
+	"DateNotEquals":             "is not",
+	"DateLessThan":              "is before",
+	"DateLessThanEquals":        "is at or before",
+	"DateGreaterThan":           "is after",
+	"DateGreaterThanEquals":     "is at or after",
+	"Bool":                      "is",
+	"BinaryEquals":              "is",
+	"IpAddress":                 "is in",
+	"NotIpAddress":              "is not in",
+}
+
+func (s Statement) when() string {
+	var clauses []string
+	for _, operator := range slices.Sorted(maps.Keys(s.Condition)) {
+		for _, key := range slices.Sorted(maps.Keys(s.Condition[operator])) {
+			clauses = append(clauses, condition(operator, key, s.Condition[operator][key]))
+		}
+	}
+	return strings.Join(clauses, " and ")
+}
+
+func condition(operator, key string, values List) string {
+	op, ifExists := strings.CutSuffix(operator, "IfExists")
+	quantifier := ""
+	if rest, ok := strings.CutPrefix(op, "ForAnyValue:"); ok {
+		op, quantifier = rest, "any value of "
+	} else if rest, ok := strings.CutPrefix(op, "ForAllValues:"); ok {
+		op, quantifier = rest, "every value of "
+	}
+
+	var clause string
+	if op == "Null" {
+		state := "is present"
+		if slices.Contains(values, "true") {
+			state = "is absent"
+		}
+		clause = quantifier + key + " " + state
+	} else {
+		verb, ok := conditionVerbs[op]
+		if !ok {
+			verb = op
+		}
+		if len(values) > 1 {
+			verb += " one of"
+		}
+		clause = fmt.Sprintf("%s%s %s %s", quantifier, key, verb, strings.Join(values, ", "))
+	}
+	if ifExists {
+		clause += " (if present)"
+	}
+	return clause
+}
+
+func (s Statement) warnings() []string {
+	if !s.Allows() {
+		return nil
+	}
+	var warnings []string
+	switch {
+	case s.Public() && s.Conditional():
+		warnings = append(warnings, "Any principal, including anonymous users, under the conditions above")
+	case s.Public():
+		warnings = append(warnings, "Any principal, including anonymous users")
+	}
+	switch {
+	case len(s.NotAction) > 0:
+		warnings = append(warnings, "NotAction allows every other action, including ones added later")
+	case slices.Contains(s.Action, "*"):
+		warnings = append(warnings, "All actions of every service")
+	default:
+		for _, action := range s.Action {
+			if strings.Contains(action, "*") {
+				warnings = append(warnings, "Wildcard action "+action)
+			}
+		}
+	}
+	if slices.Contains(s.Resource, "*") || len(s.NotResource) > 0 {
+		warnings = append(warnings, "Any resource")
+	}
+	return warnings
+}
+
+// joinList joins items as "a", "a and b" or "a, b and c", with "or" in place
+// of "and" when asked.
+func joinList(items []string, conjunction string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " " + conjunction + " " + items[len(items)-1]
+}
@@ -0,0 +1,130 @@
+// Package iampolicy reads IAM policy documents, both identity policies
+// attached to users, groups and roles and resource policies such as S3
+// bucket policies.
+package iampolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Policy is a policy document.
+type Policy struct {
+	Version   string
+	ID        string
+	Statement []Statement
+}
+
+// Statement is one statement of a policy. Fields that IAM accepts as either
+// a string or a list are always lists.
+type Statement struct {
+	Sid          string
+	Effect       string
+	Principal    Principal
+	NotPrincipal Principal
+	Action       List
+	NotAction    List
+	Resource     List
+	NotResource  List
+	// Condition maps operators, e.g. StringEquals, to context keys and
+	// the values they are compared with.
+	Condition map[string]map[string]List
+}
+
+// Principal maps principal types (AWS, Service, Federated, CanonicalUser)
+// to identifiers. The bare "*" principal is read as {"AWS": ["*"]}, which
+// IAM treats the same.
+type Principal map[string]List
+
+// List is a policy value given as a string or a list of strings. Booleans
+// and numbers are kept in their JSON spelling.
+type List []string
+
+// Parse reads a policy document.
+func Parse(document []byte) (Policy, error) {
+	var raw struct {
+		Version   string
+		ID        string
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal(document, &raw); err != nil {
+		return Policy{}, fmt.Errorf("invalid policy document: %w", err)
+	}
+
+	p := Policy{Version: raw.Version, ID: raw.ID}
+	// a policy with a single statement may give it as an object
+	if trimmed := bytes.TrimSpace(raw.Statement); len(trimmed) > 0 && trimmed[0] == '{' {
+		var s Statement
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return Policy{}, fmt.Errorf("invalid policy statement: %w", err)
+		}
+		p.Statement = []Statement{s}
+	} else if len(trimmed) > 0 {
+		if err := json.Unmarshal(trimmed, &p.Statement); err != nil {
+			return Policy{}, fmt.Errorf("invalid policy statement: %w", err)
+		}
+	}
+	return p, nil
+}
+
+func (l *List) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// keep numbers as written, e.g. 12 rather than 1.2e+01
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	values, ok := v.([]any)
+	if !ok {
+		values = []any{v}
+	}
+	// condition values may be JSON booleans and numbers, e.g.
+	// {"Bool": {"aws:SecureTransport": false}}
+	list := make(List, 0, len(values))
+	for _, value := range values {
+		switch value.(type) {
+		case string, bool, json.Number:
+			list = append(list, fmt.Sprint(value))
+		default:
+			return fmt.Errorf("expected a string or a list of strings, got %s", data)
+		}
+	}
+	*l = list
+	return nil
+}
+
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*p = Principal{"AWS": List{s}}
+		return nil
+	}
+	var m map[string]List
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("expected \"*\" or a map of principals, got %s", data)
+	}
+	*p = m
+	return nil
+}
+
+// Allows reports whether the statement grants access.
+func (s Statement) Allows() bool {
+	return s.Effect == "Allow"
+}
+
+// Public reports whether the statement applies to everyone: its principal
+// is "*", or it names the principals it does not apply to.
+func (s Statement) Public() bool {
+	return slices.Contains(s.Principal["AWS"], "*") || len(s.NotPrincipal) > 0
+}
+
+// Conditional reports whether the statement only applies under conditions.
+func (s Statement) Conditional() bool {
+	return len(s.Condition) > 0
+}
@@ -0,0 +1,94 @@
+package iampolicy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptsStringsOrLists(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"Version": "2012-10-17",
+		"Statement": {
+			"Effect": "Allow",
+			"Principal": "*",
+			"Action": "s3:GetObject",
+			"Resource": ["arn:aws:s3:::site/*", "arn:aws:s3:::site"],
+			"Condition": {"IpAddress": {"aws:SourceIp": "203.0.113.0/24"}}
+		}
+	}`))
+	assert.NoError(t, err)
+	assert.Len(t, p.Statement, 1)
+	s := p.Statement[0]
+	assert.Equal(t, Principal{"AWS": {"*"}}, s.Principal)
+	assert.Equal(t, List{"s3:GetObject"}, s.Action)
+	assert.Equal(t, List{"arn:aws:s3:::site/*", "arn:aws:s3:::site"}, s.Resource)
+	assert.Equal(t, List{"203.0.113.0/24"}, s.Condition["IpAddress"]["aws:SourceIp"])
+	assert.True(t, s.Allows())
+	assert.True(t, s.Public())
+	assert.True(t, s.Conditional())
+}
+
+func TestParseAcceptsBoolAndNumberConditions(t *testing.T) {
+	p, err := Parse([]byte(`{"Statement": {
+		"Effect": "Deny",
+		"Principal": "*",
+		"Action": "s3:*",
+		"Condition": {
+			"Bool": {"aws:SecureTransport": false},
+			"NumericLessThan": {"s3:TlsVersion": [1.2, 12]}
+		}
+	}}`))
+	assert.NoError(t, err)
+	s := p.Statement[0]
+	assert.Equal(t, List{"false"}, s.Condition["Bool"]["aws:SecureTransport"])
+	assert.Equal(t, List{"1.2", "12"}, s.Condition["NumericLessThan"]["s3:TlsVersion"])
+}
+
+func TestPublic(t *testing.T) {
+	p, err := Parse([]byte(`{"Statement": [
+		{"Effect": "Allow", "Principal": {"AWS": ["arn:aws:iam::111122223333:root"]}, "Action": "s3:*"},
+		{"Effect": "Allow", "Principal": {"Service": "cloudfront.amazonaws.com"}, "Action": "s3:GetObject"},
+		{"Effect": "Allow", "NotPrincipal": {"AWS": "arn:aws:iam::111122223333:root"}, "Action": "s3:GetObject"}
+	]}`))
+	assert.NoError(t, err)
+	assert.False(t, p.Statement[0].Public())
+	assert.False(t, p.Statement[1].Public())
+	assert.True(t, p.Statement[2].Public())
+}
+
+func TestParseRejectsInvalidDocuments(t *testing.T) {
+	_, err := Parse([]byte(`{"Statement": [{"Action": {"s3": "GetObject"}}]}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestExplain(t *testing.T) {
+	p, err := Parse([]byte(`{"Statement": [
+		{"Sid": "PublicRead", "Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::site/*",
+		 "Condition": {"IpAddress": {"aws:SourceIp": ["203.0.113.0/24", "198.51.100.0/24"]}}},
+		{"Effect": "Deny", "Principal": {"AWS": "*"}, "Action": "s3:*", "Resource": ["arn:aws:s3:::site", "arn:aws:s3:::site/*"],
+		 "Condition": {"Bool": {"aws:SecureTransport": "false"}}},
+		{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111122223333:root", "Service": "logging.s3.amazonaws.com"},
+		 "Action": ["s3:Get*", "s3:PutObject"], "Resource": "*"},
+		{"Effect": "Allow", "NotAction": "iam:*", "Resource": "*",
+		 "Condition": {"StringLikeIfExists": {"aws:PrincipalTag/team": "data-*"}}}
+	]}`))
+	assert.NoError(t, err)
+
+	explanations := Explain(p)
+	assert.Equal(t, Explanation{
+		Statement: 1,
+		Sid:       "PublicRead",
+		Effect:    "Allow",
+		Summary:   "Anyone can s3:GetObject on arn:aws:s3:::site/* when aws:SourceIp is in one of 203.0.113.0/24, 198.51.100.0/24.",
+		Warnings:  []string{"Any principal, including anonymous users, under the conditions above"},
+	}, explanations[0])
+	assert.Equal(t, "Anyone cannot s3:* on arn:aws:s3:::site and arn:aws:s3:::site/* when aws:SecureTransport is false.", explanations[1].Summary)
+	assert.Empty(t, explanations[1].Warnings)
+	assert.Equal(t, "Account 111122223333 and service logging.s3.amazonaws.com can s3:Get* and s3:PutObject on any resource.", explanations[2].Summary)
+	assert.Equal(t, []string{"Wildcard action s3:Get*", "Any resource"}, explanations[2].Warnings)
+	assert.Equal(t, "The attached identity can do anything except iam:* on any resource when aws:PrincipalTag/team matches data-* (if present).", explanations[3].Summary)
+	assert.Contains(t, explanations[3].Warnings, "NotAction allows every other action, including ones added later")
+}
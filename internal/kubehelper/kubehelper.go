@@ -2,12 +2,16 @@ package kubehelper
 
 import (
 	"context"
+	"devctl/pkg/clierr"
+	"devctl/pkg/config"
+	"devctl/pkg/printer"
+	"devctl/pkg/runner"
 	"fmt"
 	"github.com/spf13/cobra"
-	"log"
 	"os"
-	"os/exec"
+	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -45,14 +49,38 @@ func getKubeClient() (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(config)
 }
 
+// kubeError wraps a Kubernetes API error with a message and the matching error kind.
+func kubeError(err error, format string, args ...interface{}) error {
+	kind := clierr.KindRemote
+	switch {
+	case apierrors.IsNotFound(err):
+		kind = clierr.KindNotFound
+	case apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err):
+		kind = clierr.KindAuth
+	case apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) || clierr.KindOf(err) == clierr.KindTimeout:
+		kind = clierr.KindTimeout
+	case apierrors.IsBadRequest(err) || apierrors.IsInvalid(err):
+		kind = clierr.KindInput
+	}
+	return clierr.Wrap(kind, err, format, args...)
+}
+
+// runKubectl runs kubectl attached to the terminal. kubectl reports its own
+// errors, so only its exit code is passed on.
+func runKubectl(ctx context.Context, args ...string) error {
+	return clierr.Process(runner.Command("kubectl", args...).Run(ctx))
+}
+
 func setContextCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "set-context [context] [namespace]",
 		Short: "Switch Kubernetes context and namespace",
 		Args:  cobra.ExactArgs(2),
-		Run: func(cmd *cobra.Command, args []string) {
-			exec.Command("kubectl", "config", "use-context", args[0]).Run()
-			exec.Command("kubectl", "config", "set-context", "--current", "--namespace="+args[1]).Run()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := runKubectl(cmd.Context(), "config", "use-context", args[0]); err != nil {
+				return err
+			}
+			return runKubectl(cmd.Context(), "config", "set-context", "--current", "--namespace="+args[1])
 		},
 	}
 }
@@ -62,8 +90,8 @@ func restartDeploymentCmd() *cobra.Command {
 		Use:   "restart [deployment]",
 		Short: "Restart a deployment in current K8s namespace",
 		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
-			exec.Command("kubectl", "rollout", "restart", "deployment/"+args[0]).Run()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKubectl(cmd.Context(), "rollout", "restart", "deployment/"+args[0])
 		},
 	}
 }
@@ -73,36 +101,62 @@ func getLogsFromPodCmd() *cobra.Command {
 		Use:   "logs [pod]",
 		Short: "Tail logs from a pod",
 		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
-			exec.Command("kubectl", "logs", "-f", args[0]).Run()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKubectl(cmd.Context(), "logs", "-f", args[0])
 		},
 	}
 }
 
+type podRecord struct {
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace"`
+	Phase     string    `json:"phase"`
+	Node      string    `json:"node,omitempty"`
+	PodIP     string    `json:"podIp,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+var podColumns = []printer.Column[podRecord]{
+	{Header: "Name", Value: func(p podRecord) string { return p.Name }},
+	{Header: "Status", Value: func(p podRecord) string { return p.Phase }},
+	{Header: "Created", Value: func(p podRecord) string { return printer.Time(&p.Created) }},
+	{Header: "Node", Wide: true, Value: func(p podRecord) string { return printer.Or(p.Node) }},
+	{Header: "IP", Wide: true, Value: func(p podRecord) string { return printer.Or(p.PodIP) }},
+}
+
 func getPodsCmd() *cobra.Command {
 	var namespace string
 
 	cmd := &cobra.Command{
 		Use:   "get-pods",
 		Short: "List pods in a namespace",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			clientset, err := getKubeClient()
 			if err != nil {
-				log.Fatalf("Failed to create Kubernetes client: %v", err)
+				return clierr.Wrap(clierr.KindInput, err, "Failed to create Kubernetes client")
 			}
 
-			pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+			pods, err := clientset.CoreV1().Pods(namespace).List(cmd.Context(), metav1.ListOptions{})
 			if err != nil {
-				log.Fatalf("Error fetching pods: %v", err)
+				return kubeError(err, "Error fetching pods")
 			}
 
+			var records []podRecord
 			for _, pod := range pods.Items {
-				fmt.Printf("🟢 %s (%s)\n", pod.Name, pod.Status.Phase)
+				records = append(records, podRecord{
+					Name:      pod.Name,
+					Namespace: pod.Namespace,
+					Phase:     string(pod.Status.Phase),
+					Node:      pod.Spec.NodeName,
+					PodIP:     pod.Status.PodIP,
+					Created:   pod.CreationTimestamp.Time,
+				})
 			}
+			return printer.PrintAll(os.Stdout, printer.Output(cmd), podColumns, records)
 		},
 	}
 
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Namespace to list pods in")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", config.String("kube.namespace"), "Namespace to list pods in")
 	return cmd
 }
 
@@ -110,17 +164,18 @@ func currentContextCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "current-context",
 		Short: "Show the current Kubernetes context",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			kubeconfig := os.Getenv("KUBECONFIG")
 			if kubeconfig == "" {
 				kubeconfig = os.ExpandEnv("$HOME/.kube/config")
 			}
 			config, err := clientcmd.LoadFromFile(kubeconfig)
 			if err != nil {
-				log.Fatalf("Failed to load kubeconfig: %v", err)
+				return clierr.Wrap(clierr.KindInput, err, "Failed to load kubeconfig")
 			}
 
 			fmt.Printf("📌 Current context: %s\n", config.CurrentContext)
+			return nil
 		},
 	}
 }
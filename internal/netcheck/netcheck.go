@@ -1,9 +1,12 @@
 package netcheck
 
 import (
+	"devctl/pkg/clierr"
+	"devctl/pkg/config"
 	"fmt"
 	"github.com/spf13/cobra"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -15,32 +18,36 @@ func NewNetCheckCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "nw",
 		Short: "Check network reachability to a host:port",
-		Run: func(cmd *cobra.Command, args []string) {
-			address := fmt.Sprintf("%s:%d", host, port)
-			fmt.Printf("Checking %s ...\\n", address)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address := net.JoinHostPort(host, strconv.Itoa(port))
+			fmt.Printf("Checking %s ...\n", address)
 			start := time.Now()
 			conn, err := net.DialTimeout("tcp", address, timeout)
 			duration := time.Since(start)
 
 			if err != nil {
-				fmt.Printf("❌ Connection failed: %s\\n", err)
-				return
+				kind := clierr.KindOf(err)
+				if kind == clierr.KindUnknown {
+					kind = clierr.KindRemote
+				}
+				return clierr.Wrap(kind, err, "Connection failed")
 			}
 			defer func(conn net.Conn) {
 				err := conn.Close()
 				if err != nil {
-					fmt.Printf("❌ Failed to close connection: %s\\n", err)
+					fmt.Printf("❌ Failed to close connection: %s\n", err)
 				} else {
-					fmt.Printf("✅ Connection closed successfully.\\n")
+					fmt.Printf("✅ Connection closed successfully.\n")
 				}
 			}(conn)
-			fmt.Printf("✅ Success! Response time: %v \\n", duration)
+			fmt.Printf("✅ Success! Response time: %v \n", duration)
+			return nil
 		},
 	}
 
 	cmd.Flags().StringVar(&host, "host", "", "Target hostname (e.g., google.com)")
 	cmd.Flags().IntVar(&port, "port", 80, "Target port")
-	cmd.Flags().DurationVar(&timeout, "timeout", 2*time.Second, "Timeout duration")
+	cmd.Flags().DurationVar(&timeout, "timeout", config.Duration("netcheck.timeout"), "Timeout duration")
 	err := cmd.MarkFlagRequired("host")
 	if err != nil {
 		return nil
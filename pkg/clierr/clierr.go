@@ -0,0 +1,167 @@
+// Package clierr classifies command errors so devctl can exit with a code
+// that automation can rely on instead of parsing stderr.
+//
+// Exit codes:
+//
+//	0  success
+//	1  unexpected error
+//	2  invalid user input or usage
+//	3  resource not found
+//	4  authentication or authorization failure
+//	5  timeout
+//	6  remote API error
+//	7  a check found problems (stack drift, failed audit, ...)
+//	8  the user declined a confirmation prompt
+package clierr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Kind is the category of an error.
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+	KindInput
+	KindNotFound
+	KindAuth
+	KindTimeout
+	KindRemote
+	// KindCheckFailed means the command ran but what it checked is not in
+	// the expected state, e.g. a stack has drifted.
+	KindCheckFailed
+	// KindAborted means the user declined to go ahead when asked.
+	KindAborted
+)
+
+var kindNames = map[Kind]string{
+	KindUnknown:     "unknown",
+	KindInput:       "user input",
+	KindNotFound:    "not found",
+	KindAuth:        "auth failure",
+	KindTimeout:     "timeout",
+	KindRemote:      "remote API error",
+	KindCheckFailed: "check failed",
+	KindAborted:     "aborted",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// ExitCode returns the documented process exit code for the kind.
+func (k Kind) ExitCode() int {
+	if k == KindUnknown {
+		return 1
+	}
+	return int(k) + 1
+}
+
+// Error is an error with a Kind and an optional cause.
+type Error struct {
+	Kind Kind
+	Msg  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	if e.Msg == "" {
+		return e.Err.Error()
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error of the given kind.
+func New(kind Kind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Wrap annotates err with a message and a kind. It returns nil if err is nil.
+func Wrap(kind Kind, err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+// KindOf returns the kind of the outermost classified error in err's chain.
+// Unclassified timeouts are reported as KindTimeout.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) && e.Kind != KindUnknown {
+		return e.Kind
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return KindTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return KindTimeout
+	}
+	return KindUnknown
+}
+
+type exitCoder interface {
+	ExitCode() int
+}
+
+// ExitCode maps err to a process exit code. Errors that carry their own
+// exit code, such as a failed plugin process, keep it.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if kind := KindOf(err); kind != KindUnknown {
+		return kind.ExitCode()
+	}
+	var coder exitCoder
+	if errors.As(err, &coder) && coder.ExitCode() > 0 {
+		return coder.ExitCode()
+	}
+	return 1
+}
+
+type silentError struct {
+	error
+}
+
+func (e silentError) Unwrap() error {
+	return e.error
+}
+
+// Silent marks err as already reported, e.g. by a child process writing to
+// stderr, so devctl only sets the exit code.
+func Silent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return silentError{err}
+}
+
+// Process passes on the error of a child process attached to the terminal.
+// A non-zero exit is marked Silent since the process has already reported
+// it; failures to start the process are returned unchanged.
+func Process(err error) error {
+	var coder exitCoder
+	if errors.As(err, &coder) {
+		return Silent(err)
+	}
+	return err
+}
+
+// IsSilent reports whether err was marked with Silent.
+func IsSilent(err error) bool {
+	var s silentError
+	return errors.As(err, &s)
+}
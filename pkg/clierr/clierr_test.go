@@ -0,0 +1,47 @@
+package clierr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type codeError int
+
+func (c codeError) Error() string { return "exit" }
+func (c codeError) ExitCode() int { return int(c) }
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, 0},
+		{"plain", errors.New("boom"), 1},
+		{"input", New(KindInput, "missing %s", "bucket"), 2},
+		{"not found", Wrap(KindNotFound, errors.New("NoSuchBucket"), "no bucket"), 3},
+		{"auth", Wrap(KindAuth, errors.New("ExpiredToken"), "login"), 4},
+		{"deadline", fmt.Errorf("dial: %w", context.DeadlineExceeded), 5},
+		{"remote", Wrap(KindRemote, errors.New("503"), "api"), 6},
+		{"check failed", New(KindCheckFailed, "stack drifted"), 7},
+		{"aborted", New(KindAborted, "deletion cancelled"), 8},
+		{"wrapped", fmt.Errorf("outer: %w", New(KindNotFound, "inner")), 3},
+		{"exit coder", Silent(codeError(42)), 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ExitCode(tt.err))
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	assert.Equal(t, "no bucket: NoSuchBucket", Wrap(KindNotFound, errors.New("NoSuchBucket"), "no bucket").Error())
+	assert.Nil(t, Wrap(KindNotFound, nil, "no bucket"))
+	assert.True(t, IsSilent(fmt.Errorf("x: %w", Silent(errors.New("y")))))
+	assert.False(t, IsSilent(errors.New("y")))
+}
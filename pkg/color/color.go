@@ -0,0 +1,83 @@
+// Package color adds ANSI colors to output meant for a terminal. Colors are
+// left out when the output is redirected or NO_COLOR is set.
+package color
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Painter colors text when its output supports it.
+type Painter struct {
+	on bool
+}
+
+// For returns a Painter for output written to w.
+func For(w io.Writer) Painter {
+	return Painter{on: Enabled(w)}
+}
+
+// Enabled reports whether w is a terminal that should get colors.
+func Enabled(w io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+func (p Painter) paint(code, s string) string {
+	if !p.on || s == "" {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+func (p Painter) Red(s string) string    { return p.paint("31", s) }
+func (p Painter) Green(s string) string  { return p.paint("32", s) }
+func (p Painter) Yellow(s string) string { return p.paint("33", s) }
+func (p Painter) Cyan(s string) string   { return p.paint("36", s) }
+func (p Painter) Bold(s string) string   { return p.paint("1", s) }
+func (p Painter) Dim(s string) string    { return p.paint("2", s) }
+
+// JSON colors JSON text: object keys cyan, strings green, and numbers,
+// booleans and null yellow. Layout is kept as is.
+func (p Painter) JSON(s string) string {
+	if !p.on {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(s))
+			if rest := strings.TrimLeft(s[j:], " \t\r\n"); strings.HasPrefix(rest, ":") {
+				b.WriteString(p.Cyan(s[i:j]))
+			} else {
+				b.WriteString(p.Green(s[i:j]))
+			}
+			i = j
+		case c == '-' || c >= '0' && c <= '9' || c == 't' || c == 'f' || c == 'n':
+			j := i
+			for j < len(s) && !strings.ContainsRune(",:[]{} \t\r\n", rune(s[j])) {
+				j++
+			}
+			b.WriteString(p.Yellow(s[i:j]))
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,26 @@
+package color
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPainter(t *testing.T) {
+	assert.Equal(t, "\033[31mFAILED\033[0m", Painter{on: true}.Red("FAILED"))
+	assert.Equal(t, "", Painter{on: true}.Red(""))
+	assert.Equal(t, "FAILED", Painter{}.Red("FAILED"))
+
+	// buffers are never terminals
+	assert.False(t, Enabled(&bytes.Buffer{}))
+}
+
+func TestJSON(t *testing.T) {
+	in := "{\n  \"Effect\": \"Allow\",\n  \"Sid\": \"say \\\"hi\\\"\",\n  \"N\": [1, true, null]\n}"
+	assert.Equal(t, in, Painter{}.JSON(in))
+	assert.Equal(t, "{\n  \033[36m\"Effect\"\033[0m: \033[32m\"Allow\"\033[0m,\n"+
+		"  \033[36m\"Sid\"\033[0m: \033[32m\"say \\\"hi\\\"\"\033[0m,\n"+
+		"  \033[36m\"N\"\033[0m: [\033[33m1\033[0m, \033[33mtrue\033[0m, \033[33mnull\033[0m]\n}",
+		Painter{on: true}.JSON(in))
+}
@@ -0,0 +1,363 @@
+// Package config loads devctl settings from layered sources.
+//
+// Values are resolved in increasing order of precedence:
+//
+//  1. built-in defaults
+//  2. the system file, /etc/devctl/config.yaml
+//  3. the user file, $XDG_CONFIG_HOME/devctl/config.yaml (~/.config/devctl/config.yaml)
+//  4. the project file, .devctl.yaml in the working directory or its nearest parent
+//  5. DEVCTL_* environment variables, e.g. DEVCTL_AWS_REGION for aws.region
+//
+// Command-line flags take the resolved value as their default, so a flag
+// given explicitly always wins.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Scopes of the configuration files, lowest precedence first.
+const (
+	ScopeSystem  = "system"
+	ScopeUser    = "user"
+	ScopeProject = "project"
+)
+
+// Sources a value can come from besides a file scope.
+const (
+	SourceDefault = "default"
+	SourceEnv     = "env"
+)
+
+// ProjectFile is the name of the project-local configuration file.
+const ProjectFile = ".devctl.yaml"
+
+// Types of setting values. Values of typed keys are checked before they are
+// written.
+const (
+	TypeString   = ""
+	TypeDuration = "duration"
+)
+
+// Key is a configuration setting known to devctl.
+type Key struct {
+	Name        string
+	Default     string
+	Description string
+	Type        string
+}
+
+// Keys lists the settings devctl understands. Keys under "plugins." are
+// accepted as well so plugins can keep their settings in the same files.
+var Keys = []Key{
+	{Name: "aws.profile", Default: "", Description: "Shared config profile for the aws commands"},
+	{Name: "aws.region", Default: "", Description: "Region for the aws commands; empty uses the profile"},
+	{Name: "aws.endpoint-url", Default: "", Description: "Endpoint for every AWS request, e.g. LocalStack"},
+	{Name: "kube.namespace", Default: "default", Description: "Namespace used by kube get-pods"},
+	{Name: "git.remote", Default: "origin", Description: "Remote used by git push"},
+	{Name: "netcheck.timeout", Default: "2s", Description: "Dial timeout used by nw", Type: TypeDuration},
+	{Name: "output", Default: "table", Description: "Default --output format"},
+}
+
+// Value is an effective setting together with where it came from.
+type Value struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Origin string `json:"origin,omitempty"`
+}
+
+// File is a configuration file consulted while loading.
+type File struct {
+	Scope  string `json:"scope"`
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+}
+
+// Config is the merged result of all configuration layers.
+type Config struct {
+	values map[string]Value
+	files  []File
+}
+
+// Load reads every layer for the current user and working directory.
+func Load() (*Config, error) {
+	return LoadFiles(Files(), os.Environ())
+}
+
+// LoadFiles merges the defaults, the given files in order and the
+// DEVCTL_* variables found in environ. A file that cannot be read is
+// skipped: the other layers are still returned, with the first such error.
+func LoadFiles(files []File, environ []string) (*Config, error) {
+	c := &Config{values: map[string]Value{}}
+	var loadErr error
+	for _, k := range Keys {
+		c.values[k.Name] = Value{Key: k.Name, Value: k.Default, Source: SourceDefault}
+	}
+
+	for _, f := range files {
+		settings, err := readFile(f.Path)
+		if os.IsNotExist(err) {
+			c.files = append(c.files, f)
+			continue
+		}
+		f.Exists = true
+		c.files = append(c.files, f)
+		if err != nil {
+			if loadErr == nil {
+				loadErr = err
+			}
+			continue
+		}
+		for key, value := range settings {
+			c.values[key] = Value{Key: key, Value: value, Source: f.Scope, Origin: f.Path}
+		}
+	}
+
+	env := map[string]string{}
+	for _, kv := range environ {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			env[name] = value
+		}
+	}
+	for _, k := range Keys {
+		name := EnvName(k.Name)
+		if value, ok := env[name]; ok && value != "" {
+			c.values[k.Name] = Value{Key: k.Name, Value: value, Source: SourceEnv, Origin: name}
+		}
+	}
+
+	return c, loadErr
+}
+
+// Get returns the effective value of key.
+func (c *Config) Get(key string) (Value, bool) {
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// String returns the effective value of key, or "" when it is unset.
+func (c *Config) String(key string) string {
+	return c.values[key].Value
+}
+
+// Duration parses the effective value of key, falling back to the built-in
+// default when the configured value is not a valid duration.
+func (c *Config) Duration(key string) time.Duration {
+	if d, err := time.ParseDuration(c.String(key)); err == nil {
+		return d
+	}
+	d, _ := time.ParseDuration(defaultOf(key))
+	return d
+}
+
+// Values returns every effective setting sorted by key.
+func (c *Config) Values() []Value {
+	values := make([]Value, 0, len(c.values))
+	for _, v := range c.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+	return values
+}
+
+// Files returns the configuration files consulted while loading, in order.
+func (c *Config) Files() []File {
+	return c.files
+}
+
+var current *Config
+
+// SetCurrent makes c the configuration returned by Current.
+func SetCurrent(c *Config) {
+	current = c
+}
+
+// Current returns the configuration loaded by the devctl binary, or the
+// built-in defaults and environment when no files have been loaded.
+func Current() *Config {
+	if current == nil {
+		c, _ := LoadFiles(nil, os.Environ())
+		return c
+	}
+	return current
+}
+
+// String returns the effective value of key from the current configuration.
+func String(key string) string {
+	return Current().String(key)
+}
+
+// Duration returns the effective value of key from the current configuration.
+func Duration(key string) time.Duration {
+	return Current().Duration(key)
+}
+
+// EnvName returns the environment variable that overrides key.
+func EnvName(key string) string {
+	name := strings.NewReplacer(".", "_", "-", "_").Replace(key)
+	return "DEVCTL_" + strings.ToUpper(name)
+}
+
+// Known reports whether key may be read or written.
+func Known(key string) bool {
+	if strings.HasPrefix(key, "plugins.") && len(key) > len("plugins.") {
+		return true
+	}
+	for _, k := range Keys {
+		if k.Name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Check reports whether value can be stored for key.
+func Check(key, value string) error {
+	if lookup(key).Type == TypeDuration {
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("%s must be a duration such as 2s or 500ms, got %q", key, value)
+		}
+	}
+	return nil
+}
+
+func defaultOf(key string) string {
+	return lookup(key).Default
+}
+
+func lookup(key string) Key {
+	for _, k := range Keys {
+		if k.Name == key {
+			return k
+		}
+	}
+	return Key{Name: key}
+}
+
+// Dir returns the user configuration directory, $XDG_CONFIG_HOME/devctl or
+// ~/.config/devctl.
+func Dir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "devctl")
+	}
+	if runtime.GOOS == "windows" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			return filepath.Join(dir, "devctl")
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "devctl")
+}
+
+// Files returns the configuration files for the current user and working
+// directory, lowest precedence first. Files that do not exist are included.
+func Files() []File {
+	var files []File
+	if runtime.GOOS != "windows" {
+		files = append(files, File{Scope: ScopeSystem, Path: "/etc/devctl/config.yaml"})
+	}
+	if dir := Dir(); dir != "" {
+		files = append(files, File{Scope: ScopeUser, Path: filepath.Join(dir, "config.yaml")})
+	}
+	if path := projectFile(); path != "" {
+		files = append(files, File{Scope: ScopeProject, Path: path})
+	}
+	return files
+}
+
+// projectFile finds .devctl.yaml in the working directory or its nearest
+// parent. When there is none, the path in the working directory is returned.
+func projectFile() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		path := filepath.Join(dir, ProjectFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		if filepath.Dir(dir) == dir {
+			return filepath.Join(wd, ProjectFile)
+		}
+	}
+}
+
+// readFile returns the settings of a YAML file flattened to dotted keys.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	settings := map[string]string{}
+	flatten("", doc, settings)
+	return settings, nil
+}
+
+func flatten(prefix string, doc map[string]interface{}, out map[string]string) {
+	for k, v := range doc {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+		case nil:
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// Set writes key=value into the YAML file at path, creating it if needed.
+func Set(path, key, value string) error {
+	doc := map[string]interface{}{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	parts := strings.Split(key, ".")
+	node := doc
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node[part].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			node[part] = child
+		}
+		node = child
+	}
+	node[parts[len(parts)-1]] = value
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0o644)
+}
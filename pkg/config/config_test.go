@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, body string) {
+	t.Helper()
+	assert.NoError(t, os.WriteFile(path, []byte(body), 0o644))
+}
+
+func TestLoadFilesPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system.yaml")
+	user := filepath.Join(dir, "user.yaml")
+	project := filepath.Join(dir, "project.yaml")
+	writeFile(t, system, "aws:\n  region: eu-west-1\nkube:\n  namespace: platform\n")
+	writeFile(t, user, "aws:\n  region: eu-central-1\nnetcheck:\n  timeout: 5s\n")
+	writeFile(t, project, "git:\n  remote: upstream\n")
+
+	c, err := LoadFiles([]File{
+		{Scope: ScopeSystem, Path: system},
+		{Scope: ScopeUser, Path: user},
+		{Scope: ScopeProject, Path: project},
+		{Scope: ScopeProject, Path: filepath.Join(dir, "missing.yaml")},
+	}, []string{"DEVCTL_KUBE_NAMESPACE=team-a", "DEVCTL_GIT_REMOTE="})
+	assert.NoError(t, err)
+
+	region, _ := c.Get("aws.region")
+	assert.Equal(t, Value{Key: "aws.region", Value: "eu-central-1", Source: ScopeUser, Origin: user}, region)
+
+	namespace, _ := c.Get("kube.namespace")
+	assert.Equal(t, "team-a", namespace.Value)
+	assert.Equal(t, SourceEnv, namespace.Source)
+	assert.Equal(t, "DEVCTL_KUBE_NAMESPACE", namespace.Origin)
+
+	assert.Equal(t, "upstream", c.String("git.remote"))
+	assert.Equal(t, 5*time.Second, c.Duration("netcheck.timeout"))
+
+	assert.Len(t, c.Files(), 4)
+	assert.False(t, c.Files()[3].Exists)
+}
+
+func TestLoadFilesInvalidYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.yaml")
+	writeFile(t, path, "aws: [\n")
+
+	c, err := LoadFiles([]File{{Scope: ScopeUser, Path: path}}, []string{"DEVCTL_GIT_REMOTE=upstream"})
+	assert.Error(t, err)
+	// the other layers still load so `config set` can repair the file
+	assert.Equal(t, "upstream", c.String("git.remote"))
+	assert.Equal(t, "table", c.String("output"))
+	assert.Equal(t, []File{{Scope: ScopeUser, Path: path, Exists: true}}, c.Files())
+}
+
+func TestDurationFallsBackToDefault(t *testing.T) {
+	c, err := LoadFiles(nil, []string{"DEVCTL_NETCHECK_TIMEOUT=soon"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, c.Duration("netcheck.timeout"))
+}
+
+func TestSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "config.yaml")
+
+	assert.NoError(t, Set(path, "aws.region", "ap-south-1"))
+	assert.NoError(t, Set(path, "git.remote", "upstream"))
+
+	c, err := LoadFiles([]File{{Scope: ScopeUser, Path: path}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ap-south-1", c.String("aws.region"))
+	assert.Equal(t, "upstream", c.String("git.remote"))
+}
+
+func TestCheck(t *testing.T) {
+	assert.NoError(t, Check("netcheck.timeout", "500ms"))
+	assert.Error(t, Check("netcheck.timeout", "abc"))
+	assert.NoError(t, Check("aws.region", "abc"))
+}
+
+func TestKnown(t *testing.T) {
+	assert.True(t, Known("aws.region"))
+	assert.True(t, Known("plugins.acme.token"))
+	assert.False(t, Known("aws.regoin"))
+	assert.False(t, Known("plugins."))
+}
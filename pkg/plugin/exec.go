@@ -0,0 +1,215 @@
+package plugin
+
+import (
+	"bufio"
+	"devctl/pkg/clierr"
+	"devctl/pkg/config"
+	"devctl/pkg/printer"
+	"devctl/pkg/runner"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Prefix is the file name prefix that marks an executable as a devctl plugin.
+const Prefix = "devctl-"
+
+// describeMarker is looked for in the first lines of a plugin file and provides
+// the short help text shown by `devctl help`.
+const describeMarker = "devctl:"
+
+// Executable is an external devctl-<name> program found on disk.
+type Executable struct {
+	Name  string
+	Path  string
+	Short string
+}
+
+// DefaultDirs returns the plugin directories searched before PATH: every entry
+// of DEVCTL_PLUGIN_PATH followed by the user plugin directory.
+func DefaultDirs() []string {
+	var dirs []string
+	if env := os.Getenv("DEVCTL_PLUGIN_PATH"); env != "" {
+		dirs = append(dirs, filepath.SplitList(env)...)
+	}
+	if dir := config.Dir(); dir != "" {
+		dirs = append(dirs, filepath.Join(dir, "plugins"))
+	}
+	return dirs
+}
+
+// Discover returns the executable plugins found in dirs and then on PATH,
+// sorted by name. When two files share a name the first one found wins.
+func Discover(dirs ...string) []Executable {
+	dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+
+	seen := map[string]bool{}
+	var found []Executable
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := pluginName(entry.Name())
+			if !ok || seen[name] {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			found = append(found, Executable{Name: name, Path: path, Short: describe(path)})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found
+}
+
+// Command wraps the plugin in a cobra command. All arguments, including
+// --help, are passed through to the plugin untouched.
+func (e Executable) Command(version string) *cobra.Command {
+	short := e.Short
+	if short == "" {
+		short = fmt.Sprintf("Run the %s plugin", e.Name)
+	}
+
+	return &cobra.Command{
+		Use:                e.Name,
+		Short:              short,
+		Long:               fmt.Sprintf("%s\n\nPlugin executable: %s", short, e.Path),
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// With flag parsing disabled, devctl's own flags given before
+			// the plugin name arrive in args too; apply them here.
+			flags := cmd.InheritedFlags()
+			global := globalFlags(os.Args[1:], args, e.Name, flags)
+			if err := flags.Parse(global); err != nil {
+				return clierr.Wrap(clierr.KindInput, err, "")
+			}
+
+			c := runner.Command(e.Path, args[len(global):]...)
+			c.Env = append(os.Environ(), Env(e.Name, version, printer.Output(cmd))...)
+
+			// The plugin reports its own errors; its exit code is passed on.
+			return clierr.Process(c.Run(cmd.Context()))
+		},
+	}
+}
+
+// globalFlags returns the leading part of args that came before the plugin
+// name on the full command line raw.
+func globalFlags(raw, args []string, name string, flags *pflag.FlagSet) []string {
+	for i := 0; i < len(raw); i++ {
+		arg := raw[i]
+		if arg == name {
+			return args[:i]
+		}
+		if i == len(args) || arg != args[i] || !strings.HasPrefix(arg, "-") || arg == "--" {
+			return nil
+		}
+		var f *pflag.Flag
+		if long, ok := strings.CutPrefix(arg, "--"); ok {
+			f = flags.Lookup(long)
+		} else if len(arg) == 2 {
+			f = flags.ShorthandLookup(arg[1:])
+		}
+		// a flag that takes a value, given as "-o json", uses the next word
+		if f != nil && f.NoOptDefVal == "" && !strings.Contains(arg, "=") {
+			i++
+		}
+	}
+	return nil
+}
+
+// Env returns the DEVCTL_* variables passed to every executable plugin:
+//
+//	DEVCTL_PLUGIN_NAME    name of the plugin being run
+//	DEVCTL_BIN            absolute path of the devctl binary
+//	DEVCTL_VERSION        devctl version
+//	DEVCTL_KUBE_CONTEXT   current context of the active kubeconfig
+//	DEVCTL_AWS_PROFILE    AWS profile in effect
+//	DEVCTL_OUTPUT         requested output format
+func Env(name, version, output string) []string {
+	bin, _ := os.Executable()
+
+	profile := config.String("aws.profile")
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	return []string{
+		"DEVCTL_PLUGIN_NAME=" + name,
+		"DEVCTL_BIN=" + bin,
+		"DEVCTL_VERSION=" + version,
+		"DEVCTL_KUBE_CONTEXT=" + kubeContext(),
+		"DEVCTL_AWS_PROFILE=" + profile,
+		"DEVCTL_OUTPUT=" + output,
+	}
+}
+
+func kubeContext() string {
+	cfg, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return ""
+	}
+	return cfg.CurrentContext
+}
+
+func pluginName(file string) (string, bool) {
+	if !strings.HasPrefix(file, Prefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(file, Prefix)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name, name != ""
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(path))
+		return ext == ".exe" || ext == ".bat" || ext == ".cmd"
+	}
+	return info.Mode()&0o111 != 0
+}
+
+// describe reads the short help text from a "# devctl: ..." comment in the
+// first lines of a plugin script. Binaries simply yield no description.
+func describe(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < 10 && scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimLeft(line, "#/;- ")
+		if strings.HasPrefix(line, describeMarker) {
+			return strings.TrimSpace(strings.TrimPrefix(line, describeMarker))
+		}
+	}
+	return ""
+}
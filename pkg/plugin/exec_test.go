@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePlugin(t *testing.T, dir, file, body string, mode os.FileMode) {
+	t.Helper()
+	err := os.WriteFile(filepath.Join(dir, file), []byte(body), mode)
+	assert.NoError(t, err)
+}
+
+func TestDiscover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executable bits are not used on windows")
+	}
+	first, second := t.TempDir(), t.TempDir()
+	t.Setenv("PATH", "")
+
+	writePlugin(t, first, "devctl-hello", "#!/bin/sh\n# devctl: Say hello\n", 0o755)
+	writePlugin(t, first, "devctl-notexec", "#!/bin/sh\n", 0o644)
+	writePlugin(t, first, "other-tool", "#!/bin/sh\n", 0o755)
+	writePlugin(t, second, "devctl-hello", "#!/bin/sh\n# devctl: Shadowed\n", 0o755)
+	writePlugin(t, second, "devctl-bye", "#!/bin/sh\n", 0o755)
+
+	found := Discover(first, second)
+
+	assert.Len(t, found, 2)
+	assert.Equal(t, "bye", found[0].Name)
+	assert.Equal(t, "", found[0].Short)
+	assert.Equal(t, "hello", found[1].Name)
+	assert.Equal(t, "Say hello", found[1].Short)
+	assert.Equal(t, filepath.Join(first, "devctl-hello"), found[1].Path)
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+	env := Env("hello", "1.2.3", "json")
+
+	assert.Contains(t, env, "DEVCTL_PLUGIN_NAME=hello")
+	assert.Contains(t, env, "DEVCTL_VERSION=1.2.3")
+	assert.Contains(t, env, "DEVCTL_AWS_PROFILE=default")
+	assert.Contains(t, env, "DEVCTL_OUTPUT=json")
+	assert.Contains(t, env, "DEVCTL_KUBE_CONTEXT=")
+}
+
+func TestGlobalFlags(t *testing.T) {
+	flags := pflag.NewFlagSet("devctl", pflag.ContinueOnError)
+	flags.StringP("output", "o", "table", "")
+	flags.BoolP("verbose", "v", false, "")
+
+	// cobra hands the plugin every argument except its name
+	global := globalFlags([]string{"-o", "json", "-v", "hello", "-o", "yaml"}, []string{"-o", "json", "-v", "-o", "yaml"}, "hello", flags)
+	assert.Equal(t, []string{"-o", "json", "-v"}, global)
+
+	global = globalFlags([]string{"--output=name", "hello", "x"}, []string{"--output=name", "x"}, "hello", flags)
+	assert.Equal(t, []string{"--output=name"}, global)
+
+	global = globalFlags([]string{"hello", "-o", "json"}, []string{"-o", "json"}, "hello", flags)
+	assert.Empty(t, global)
+}
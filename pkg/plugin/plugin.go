@@ -0,0 +1,134 @@
+// Package plugin lets commands be compiled into devctl or discovered on disk.
+//
+// A custom devctl distribution registers its own commands from an init
+// function and is blank-imported next to the built-in ones:
+//
+//	func init() {
+//		plugin.Register(plugin.New("acme", "1.0.0", acme.NewCmd))
+//	}
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// Plugin is a top-level devctl command compiled into the binary.
+type Plugin interface {
+	// Name is the unique plugin name, normally the name of its command.
+	Name() string
+	// Version is the plugin's own version, shown by `devctl version`.
+	Version() string
+	// Command builds the cobra command tree for the plugin.
+	Command() *cobra.Command
+	// Init runs once the command tree is assembled, before arguments are parsed.
+	Init(root *cobra.Command) error
+	// Shutdown runs after the command has finished, whether it failed or not.
+	Shutdown() error
+}
+
+type simplePlugin struct {
+	name    string
+	version string
+	newCmd  func() *cobra.Command
+}
+
+// New returns a Plugin with no-op lifecycle hooks around a command constructor.
+func New(name, version string, newCmd func() *cobra.Command) Plugin {
+	return &simplePlugin{name: name, version: version, newCmd: newCmd}
+}
+
+func (p *simplePlugin) Name() string                   { return p.name }
+func (p *simplePlugin) Version() string                { return p.version }
+func (p *simplePlugin) Command() *cobra.Command        { return p.newCmd() }
+func (p *simplePlugin) Init(root *cobra.Command) error { return nil }
+func (p *simplePlugin) Shutdown() error                { return nil }
+
+// Registry holds plugins in registration order.
+type Registry struct {
+	mu      sync.Mutex
+	plugins []Plugin
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds p to the registry. Names must be unique.
+func (r *Registry) Register(p Plugin) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.plugins {
+		if existing.Name() == p.Name() {
+			return fmt.Errorf("plugin %q is already registered", p.Name())
+		}
+	}
+	r.plugins = append(r.plugins, p)
+	return nil
+}
+
+// Lookup returns the plugin registered under name, or nil.
+func (r *Registry) Lookup(name string) Plugin {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.plugins {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Plugins returns the registered plugins in registration order.
+func (r *Registry) Plugins() []Plugin {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Plugin(nil), r.plugins...)
+}
+
+// Install adds every plugin's command to root and then runs the Init hooks.
+func (r *Registry) Install(root *cobra.Command) error {
+	plugins := r.Plugins()
+	for _, p := range plugins {
+		root.AddCommand(p.Command())
+	}
+	for _, p := range plugins {
+		if err := p.Init(root); err != nil {
+			return fmt.Errorf("plugin %s: %w", p.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Shutdown runs every plugin's Shutdown hook and joins the errors.
+func (r *Registry) Shutdown() error {
+	var errs []error
+	for _, p := range r.Plugins() {
+		if err := p.Shutdown(); err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", p.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the registry used by the devctl binary.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds p to the default registry. It panics on a duplicate name,
+// since that can only happen through a programming error at init time.
+func Register(p Plugin) {
+	if err := defaultRegistry.Register(p); err != nil {
+		panic(err)
+	}
+}
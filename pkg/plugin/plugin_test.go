@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+type hookPlugin struct {
+	Plugin
+	initErr   error
+	initRoot  *cobra.Command
+	shutdowns int
+}
+
+func (p *hookPlugin) Init(root *cobra.Command) error {
+	p.initRoot = root
+	return p.initErr
+}
+
+func (p *hookPlugin) Shutdown() error {
+	p.shutdowns++
+	return nil
+}
+
+func newCmd(name string) func() *cobra.Command {
+	return func() *cobra.Command { return &cobra.Command{Use: name} }
+}
+
+func TestRegistryRejectsDuplicates(t *testing.T) {
+	r := NewRegistry()
+
+	assert.NoError(t, r.Register(New("hello", "1.0.0", newCmd("hello"))))
+	assert.Error(t, r.Register(New("hello", "2.0.0", newCmd("hello"))))
+	assert.Len(t, r.Plugins(), 1)
+	assert.Equal(t, "1.0.0", r.Lookup("hello").Version())
+	assert.Nil(t, r.Lookup("missing"))
+}
+
+func TestRegistryInstallAndShutdown(t *testing.T) {
+	r := NewRegistry()
+	hooked := &hookPlugin{Plugin: New("hooked", "", newCmd("hooked"))}
+	assert.NoError(t, r.Register(New("plain", "", newCmd("plain"))))
+	assert.NoError(t, r.Register(hooked))
+
+	root := &cobra.Command{Use: "devctl"}
+	assert.NoError(t, r.Install(root))
+
+	assert.Len(t, root.Commands(), 2)
+	assert.Equal(t, root, hooked.initRoot)
+
+	assert.NoError(t, r.Shutdown())
+	assert.Equal(t, 1, hooked.shutdowns)
+}
+
+func TestRegistryInstallInitError(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(&hookPlugin{
+		Plugin:  New("broken", "", newCmd("broken")),
+		initErr: errors.New("boom"),
+	}))
+
+	err := r.Install(&cobra.Command{Use: "devctl"})
+	assert.EqualError(t, err, "plugin broken: boom")
+}
@@ -0,0 +1,263 @@
+// Package printer renders command results in the format chosen with --output.
+//
+// Commands describe their records once as a list of columns and feed typed
+// values to a Printer; the same records then come out as a table, JSON,
+// YAML, bare names or through a Go template or JSONPath expression.
+package printer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"devctl/pkg/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// Supported output formats. Template formats take their expression after
+// "=", e.g. -o go-template={{.name}} or -o jsonpath={.name}.
+const (
+	FormatTable      = "table"
+	FormatWide       = "wide"
+	FormatJSON       = "json"
+	FormatYAML       = "yaml"
+	FormatName       = "name"
+	FormatGoTemplate = "go-template"
+	FormatJSONPath   = "jsonpath"
+)
+
+// FlagName is the name of the global output flag.
+const FlagName = "output"
+
+// Column describes one field of a record in table output.
+type Column[T any] struct {
+	Header string
+	// Wide columns are only shown with -o wide.
+	Wide  bool
+	Value func(T) string
+}
+
+// Printer writes records of type T in a single output format.
+type Printer[T any] struct {
+	w       io.Writer
+	format  string
+	columns []Column[T]
+
+	table  *tabwriter.Writer
+	header bool
+	tmpl   *template.Template
+	jp     *jsonpath.JSONPath
+	items  []T
+}
+
+// AddFlag registers the global --output/-o flag on flags.
+func AddFlag(flags *pflag.FlagSet) {
+	flags.StringP(FlagName, "o", config.String("output"),
+		"Output format: table, wide, json, yaml, name, go-template=TEMPLATE or jsonpath=EXPR")
+}
+
+// Output returns the output format requested for cmd, falling back to the
+// configured default when the flag is not available.
+func Output(cmd *cobra.Command) string {
+	if cmd != nil {
+		if f := cmd.Flags().Lookup(FlagName); f != nil {
+			return f.Value.String()
+		}
+	}
+	return config.String("output")
+}
+
+// New returns a printer for the given format. The first column doubles as
+// the record name for -o name.
+func New[T any](w io.Writer, output string, columns []Column[T]) (*Printer[T], error) {
+	format, expr, _ := strings.Cut(output, "=")
+	p := &Printer[T]{w: w, format: format, columns: columns}
+
+	switch format {
+	case FormatTable, FormatWide:
+		p.table = tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		if format == FormatTable {
+			p.columns = nil
+			for _, c := range columns {
+				if !c.Wide {
+					p.columns = append(p.columns, c)
+				}
+			}
+		}
+	case FormatJSON, FormatYAML, FormatName:
+	case FormatGoTemplate, "template":
+		p.format = FormatGoTemplate
+		tmpl, err := template.New("output").Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid go-template: %w", err)
+		}
+		p.tmpl = tmpl
+	case FormatJSONPath:
+		if !strings.Contains(expr, "{") {
+			expr = "{" + expr + "}"
+		}
+		p.jp = jsonpath.New("output").AllowMissingKeys(true)
+		if err := p.jp.Parse(expr); err != nil {
+			return nil, fmt.Errorf("invalid jsonpath: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown output format %q", output)
+	}
+
+	return p, nil
+}
+
+// Validate reports whether output is a format New accepts.
+func Validate(output string) error {
+	_, err := New(io.Discard, output, []Column[struct{}]{})
+	return err
+}
+
+// IsTable reports whether output is one of the table formats, for commands
+// that render their own human-readable view instead of plain rows.
+func IsTable(output string) bool {
+	return output == FormatTable || output == FormatWide
+}
+
+// Print writes a single record. JSON and YAML are collected and written by
+// Flush as one list; every other format writes the record right away.
+func (p *Printer[T]) Print(item T) error {
+	switch p.format {
+	case FormatTable, FormatWide:
+		p.writeHeader()
+		values := make([]string, len(p.columns))
+		for i, c := range p.columns {
+			values[i] = c.Value(item)
+		}
+		_, err := fmt.Fprintln(p.table, strings.Join(values, "\t"))
+		return err
+	case FormatName:
+		_, err := fmt.Fprintln(p.w, p.columns[0].Value(item))
+		return err
+	case FormatGoTemplate, FormatJSONPath:
+		return p.execute(item)
+	default:
+		p.items = append(p.items, item)
+		return nil
+	}
+}
+
+// Sync writes out table rows buffered so far, letting long listings appear
+// page by page. Column widths are computed per batch.
+func (p *Printer[T]) Sync() error {
+	if p.table == nil || !p.header {
+		return nil
+	}
+	return p.table.Flush()
+}
+
+// Flush completes the output. It must be called once all records are printed.
+func (p *Printer[T]) Flush() error {
+	switch p.format {
+	case FormatTable, FormatWide:
+		p.writeHeader()
+		return p.table.Flush()
+	case FormatJSON:
+		items := p.items
+		if items == nil {
+			items = []T{}
+		}
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.w, string(data))
+		return err
+	case FormatYAML:
+		items := p.items
+		if items == nil {
+			items = []T{}
+		}
+		data, err := yaml.Marshal(items)
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(data)
+		return err
+	}
+	return nil
+}
+
+func (p *Printer[T]) writeHeader() {
+	if p.header {
+		return
+	}
+	p.header = true
+	headers := make([]string, len(p.columns))
+	for i, c := range p.columns {
+		headers[i] = strings.ToUpper(c.Header)
+	}
+	fmt.Fprintln(p.table, strings.Join(headers, "\t"))
+}
+
+// execute runs the template against the record's JSON form, so field names
+// match what -o json prints.
+func (p *Printer[T]) execute(item T) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if p.tmpl != nil {
+		err = p.tmpl.Execute(&buf, obj)
+	} else {
+		err = p.jp.Execute(&buf, obj)
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	_, err = p.w.Write(buf.Bytes())
+	return err
+}
+
+// PrintAll writes all items at once.
+func PrintAll[T any](w io.Writer, output string, columns []Column[T], items []T) error {
+	p, err := New(w, output, columns)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := p.Print(item); err != nil {
+			return err
+		}
+	}
+	return p.Flush()
+}
+
+// Time formats an optional timestamp for table output.
+func Time(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Or returns s, or "-" when s is empty, to keep table columns aligned.
+func Or(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
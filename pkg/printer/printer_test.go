@@ -0,0 +1,75 @@
+package printer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type record struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+	Zone string `json:"zone,omitempty"`
+}
+
+var columns = []Column[record]{
+	{Header: "Name", Value: func(r record) string { return r.Name }},
+	{Header: "Zone", Wide: true, Value: func(r record) string { return Or(r.Zone) }},
+}
+
+var records = []record{
+	{Name: "alpha", Size: 1, Zone: "a"},
+	{Name: "beta", Size: 2},
+}
+
+func render(t *testing.T, output string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, PrintAll(&buf, output, columns, records))
+	return buf.String()
+}
+
+func TestPrintFormats(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"table", "NAME\nalpha\nbeta\n"},
+		{"wide", "NAME    ZONE\nalpha   a\nbeta    -\n"},
+		{"name", "alpha\nbeta\n"},
+		{"json", "[\n  {\n    \"name\": \"alpha\",\n    \"size\": 1,\n    \"zone\": \"a\"\n  },\n  {\n    \"name\": \"beta\",\n    \"size\": 2\n  }\n]\n"},
+		{"yaml", "- name: alpha\n  size: 1\n  zone: a\n- name: beta\n  size: 2\n"},
+		{"go-template={{.name}}={{.size}}", "alpha=1\nbeta=2\n"},
+		{"jsonpath={.size}", "1\n2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			assert.Equal(t, tt.want, render(t, tt.output))
+		})
+	}
+}
+
+func TestPrintEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, PrintAll(&buf, "json", columns, nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestNewRejectsUnknownFormat(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, "xml", columns)
+	assert.EqualError(t, err, `unknown output format "xml"`)
+
+	_, err = New(&bytes.Buffer{}, "go-template={{.name", columns)
+	assert.Error(t, err)
+
+	assert.Error(t, Validate("xml"))
+	assert.NoError(t, Validate("jsonpath={.name}"))
+}
+
+func TestIsTable(t *testing.T) {
+	assert.True(t, IsTable("table"))
+	assert.True(t, IsTable("wide"))
+	assert.False(t, IsTable("json"))
+	assert.False(t, IsTable("go-template={{.name}}"))
+}
@@ -0,0 +1,64 @@
+// Package progress reports the status of long-running operations such as
+// waiting for a stack or an instance to settle.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Indicator shows a message with a changing status. On a terminal the line
+// is redrawn in place with the elapsed time; elsewhere, e.g. in CI logs, a
+// line is written only when the status changes.
+type Indicator struct {
+	mu     sync.Mutex
+	w      io.Writer
+	tty    bool
+	msg    string
+	status string
+	start  time.Time
+}
+
+// New starts an indicator for msg writing to w, usually stderr.
+func New(w io.Writer, msg string) *Indicator {
+	return &Indicator{w: w, tty: IsTerminal(w), msg: msg, start: time.Now()}
+}
+
+// IsTerminal reports whether w is an interactive terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// Update shows status next to the message.
+func (i *Indicator) Update(status string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.tty {
+		fmt.Fprintf(i.w, "\r\033[K⏳ %s %s (%s)", i.msg, status, i.elapsed())
+	} else if status != i.status {
+		fmt.Fprintf(i.w, "⏳ %s %s\n", i.msg, status)
+	}
+	i.status = status
+}
+
+// Done ends the line with a final status.
+func (i *Indicator) Done(status string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.tty {
+		fmt.Fprint(i.w, "\r\033[K")
+	}
+	fmt.Fprintf(i.w, "%s %s (%s)\n", i.msg, status, i.elapsed())
+}
+
+func (i *Indicator) elapsed() time.Duration {
+	return time.Since(i.start).Round(time.Second)
+}
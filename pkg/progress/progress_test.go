@@ -0,0 +1,21 @@
+package progress
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndicatorWithoutTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	p := New(&buf, "Detecting drift for web")
+	p.Update("in progress")
+	p.Update("in progress")
+	p.Update("almost")
+	p.Done("done")
+
+	assert.Equal(t, "⏳ Detecting drift for web in progress\n"+
+		"⏳ Detecting drift for web almost\n"+
+		"Detecting drift for web done (0s)\n", buf.String())
+}
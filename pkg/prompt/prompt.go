@@ -0,0 +1,44 @@
+// Package prompt asks the user to confirm destructive actions.
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Confirm asks a yes/no question on out and reads the answer from in.
+// Anything but "y" or "yes", including end of input, is a no.
+func Confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+	answer, err := ask(in, out, question+" [y/N]: ")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// ConfirmText asks the user to type want, e.g. the name of the resource
+// about to be deleted, which guards against confirming out of habit.
+func ConfirmText(in io.Reader, out io.Writer, question, want string) (bool, error) {
+	answer, err := ask(in, out, fmt.Sprintf("%s Type %q to confirm: ", question, want))
+	if err != nil {
+		return false, err
+	}
+	return answer == want, nil
+}
+
+func ask(in io.Reader, out io.Writer, prompt string) (string, error) {
+	fmt.Fprint(out, prompt)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if errors.Is(err, io.EOF) && line == "" {
+		// no answer, e.g. stdin is closed in CI
+		fmt.Fprintln(out)
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,41 @@
+package prompt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		ok, err := Confirm(strings.NewReader(tt.input), &out, "Stop 3 instances?")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, ok, "input %q", tt.input)
+		assert.True(t, strings.HasPrefix(out.String(), "Stop 3 instances? [y/N]: "))
+	}
+}
+
+func TestConfirmText(t *testing.T) {
+	var out bytes.Buffer
+	ok, err := ConfirmText(strings.NewReader("prod-web\n"), &out, "Delete stack prod-web?", "prod-web")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, `Delete stack prod-web? Type "prod-web" to confirm: `, out.String())
+
+	ok, err = ConfirmText(strings.NewReader("prod-wbe\n"), &out, "Delete stack prod-web?", "prod-web")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,130 @@
+// Package runner runs external programs such as git, kubectl, ssh and
+// plugins. Arguments are passed to the program as argv, never through a
+// shell, so paths and names with spaces or metacharacters are safe.
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Verbose makes Run print every command line to Log before running it.
+// Commands with Echo set are always printed.
+var Verbose bool
+
+// Log receives the command lines printed in verbose mode.
+var Log io.Writer = os.Stderr
+
+// GracePeriod is how long a program may take to exit after its context is
+// cancelled before it is killed.
+var GracePeriod = 10 * time.Second
+
+// forwarded are the signals passed on to a running program instead of
+// stopping devctl.
+var forwarded = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// AddFlag registers the global --verbose flag.
+func AddFlag(flags *pflag.FlagSet) {
+	flags.BoolVarP(&Verbose, "verbose", "v", false, "Print the external commands devctl runs")
+}
+
+// Cmd is an external program to run. Its standard streams default to those
+// of devctl.
+type Cmd struct {
+	Name   string
+	Args   []string
+	Env    []string
+	Dir    string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Echo prints the command line even without --verbose, for commands
+	// the user should see, like the git invocations behind git helpers.
+	Echo bool
+}
+
+// Command returns a Cmd running name with args attached to the terminal.
+func Command(name string, args ...string) *Cmd {
+	return &Cmd{Name: name, Args: args, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+// Run runs the program and waits for it. Interrupts received meanwhile are
+// forwarded to it; when ctx is cancelled it is interrupted and, after
+// GracePeriod, killed.
+func (c *Cmd) Run(ctx context.Context) error {
+	if Verbose || c.Echo {
+		fmt.Fprintf(Log, "▶️ %s\n", c)
+	}
+
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = c.Stdin, c.Stdout, c.Stderr
+	cmd.Env, cmd.Dir = c.Env, c.Dir
+
+	// a forwarded signal already asked the program to stop
+	var signalled atomic.Bool
+	cmd.Cancel = func() error {
+		if signalled.Load() {
+			return nil
+		}
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = GracePeriod
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwarded...)
+	defer signal.Stop(sigs)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				signalled.Store(true)
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return cmd.Wait()
+}
+
+// Output runs the program and returns what it wrote to stdout.
+func (c *Cmd) Output(ctx context.Context) ([]byte, error) {
+	var out bytes.Buffer
+	c.Stdout = &out
+	err := c.Run(ctx)
+	return out.Bytes(), err
+}
+
+// String returns the command line quoted for a POSIX shell, so verbose
+// output can be pasted into a terminal.
+func (c *Cmd) String() string {
+	words := []string{quote(c.Name)}
+	for _, arg := range c.Args {
+		words = append(words, quote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+func quote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
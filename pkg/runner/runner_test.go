@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringQuotesArguments(t *testing.T) {
+	c := Command("ssh", "-i", "/home/me/my keys/id", "user@10.0.0.1", "echo $HOME; rm -rf /", "it's", "")
+	assert.Equal(t, `ssh -i '/home/me/my keys/id' user@10.0.0.1 'echo $HOME; rm -rf /' 'it'\''s' ''`, c.String())
+}
+
+func TestRunPassesArgvUnchanged(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	out, err := Command(sh, "-c", `printf '%s|' "$@"`, "sh", "a b", "$(id)", ";").Output(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "a b|$(id)|;|", string(out))
+}
+
+func TestRunVerbose(t *testing.T) {
+	var log bytes.Buffer
+	Verbose, Log = true, &log
+	defer func() { Verbose, Log = false, os.Stderr }()
+
+	_ = Command("devctl-missing-program", "x y").Run(context.Background())
+	assert.Equal(t, "▶️ devctl-missing-program 'x y'\n", log.String())
+}
+
+func TestRunCancelInterruptsProgram(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("no sleep")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = Command(sleep, "10").Run(ctx)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestRunCancelSendsInterrupt(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// cancel, like Ctrl-C in devctl, once the trap is in place
+	var out bytes.Buffer
+	c := Command(sh, "-c", `trap 'echo interrupted; exit 3' INT; echo ready; while :; do sleep 0.01; done`)
+	c.Stdout = writerFunc(func(p []byte) (int, error) {
+		cancel()
+		return out.Write(p)
+	})
+	err = c.Run(ctx)
+	var exitErr *exec.ExitError
+	if assert.ErrorAs(t, err, &exitErr) {
+		assert.Equal(t, 3, exitErr.ExitCode())
+	}
+	assert.Equal(t, "ready\ninterrupted\n", out.String())
+}
@@ -1 +1,28 @@
+// Package utils holds small formatting helpers shared by the commands.
 package utils
+
+import (
+	"fmt"
+	"strconv"
+)
+
+var sizeUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// HumanSize formats a byte count with binary units and one decimal, e.g.
+// "512 B", "1.5 KiB" or "3.0 GiB".
+func HumanSize(bytes int64) string {
+	if bytes < 1024 {
+		return strconv.FormatInt(bytes, 10) + " B"
+	}
+	size := float64(bytes) / 1024
+	unit := 0
+	for size >= 1024 && unit < len(sizeUnits)-1 {
+		size /= 1024
+		unit++
+	}
+	// 1023.96 KiB would round to "1024.0 KiB"
+	if s := fmt.Sprintf("%.1f", size); s == "1024.0" && unit < len(sizeUnits)-1 {
+		return "1.0 " + sizeUnits[unit+1]
+	}
+	return fmt.Sprintf("%.1f %s", size, sizeUnits[unit])
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1048575, "1.0 MiB"},
+		{5 << 30, "5.0 GiB"},
+		{3 << 50, "3.0 PiB"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, HumanSize(tt.bytes), "%d bytes", tt.bytes)
+	}
+}